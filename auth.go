@@ -0,0 +1,233 @@
+package geerpc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"geerpc/codec"
+	"io"
+	"strings"
+)
+
+// 认证在Option之后、codec开始工作之前进行， 只在Option.AuthScheme不为空时发生：
+//
+//	client -> server: Option， AuthScheme为客户端使用的认证方式
+//	server -> client: authChallenge， 随机生成的challenge
+//	client -> server: authCredential， 客户端根据challenge生成的凭证
+//	server -> client: authResult， Error不为空表示认证失败， Code为对应的错误码， 服务端随后关闭连接
+//
+// 所有消息都是一行JSON。 设置了Authenticator的服务器收到没有认证的连接时，
+// 对第一个请求返回ErrUnauthenticated后关闭连接
+
+// ErrUnauthenticated 表示客户端没有通过认证
+var ErrUnauthenticated error = NewError(CodeUnauthenticated, "rpc server: unauthenticated")
+
+type authChallenge struct {
+	Challenge []byte
+}
+
+type authCredential struct {
+	Credential string
+}
+
+type authResult struct {
+	Error string
+	Code  Code `json:",omitempty"`
+}
+
+// Authenticator 在服务端验证客户端的凭证
+type Authenticator interface {
+	// Scheme 返回认证方式的名称， 与客户端Credentials的Scheme对应
+	Scheme() string
+	// Authenticate 验证客户端针对challenge给出的凭证， 通过时返回调用方的身份
+	Authenticate(challenge []byte, credential string) (principal string, err error)
+}
+
+// Credentials 在客户端根据服务端的challenge生成凭证， 设置在Option.Credentials中
+type Credentials interface {
+	Scheme() string
+	Credential(challenge []byte) (string, error)
+}
+
+// SetAuthenticators 设置服务器支持的认证方式， 设置之后所有连接都必须通过其中一种认证
+func (server *Server) SetAuthenticators(authenticators ...Authenticator) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.authenticators = make(map[string]Authenticator, len(authenticators))
+	for _, a := range authenticators {
+		server.authenticators[a.Scheme()] = a
+	}
+}
+
+// 返回是否需要认证， 以及scheme对应的Authenticator
+func (server *Server) getAuthenticator(scheme string) (bool, Authenticator) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return len(server.authenticators) > 0, server.authenticators[scheme]
+}
+
+// authenticate 与客户端完成认证， 返回调用方的身份
+// 服务器没有设置Authenticator时接受任何凭证， 身份为空
+func (server *Server) authenticate(conn io.Writer, dec *json.Decoder, scheme string) (string, error) {
+	required, a := server.getAuthenticator(scheme)
+	challenge := make([]byte, 32)
+	_, _ = rand.Read(challenge)
+	enc := json.NewEncoder(conn)
+	if err := enc.Encode(&authChallenge{Challenge: challenge}); err != nil {
+		return "", err
+	}
+	var cred authCredential
+	if err := dec.Decode(&cred); err != nil {
+		return "", err
+	}
+	var principal string
+	var err error
+	switch {
+	case !required:
+	case a == nil:
+		err = errors.New("unsupported auth scheme " + scheme)
+	default:
+		principal, err = a.Authenticate(challenge, cred.Credential)
+	}
+	if err != nil {
+		_ = enc.Encode(&authResult{Error: ErrUnauthenticated.Error(), Code: CodeUnauthenticated})
+		return "", err
+	}
+	return principal, enc.Encode(&authResult{})
+}
+
+// rejectUnauthenticated 对没有认证的连接上的第一个请求返回ErrUnauthenticated
+func (server *Server) rejectUnauthenticated(cc codec.Codec) {
+	var h codec.Header
+	if err := cc.ReadHeader(&h); err != nil {
+		return
+	}
+	_ = cc.ReadBody(nil)
+	server.countRejected(nil, ErrUnauthenticated)
+	if h.Type == codec.MsgOneWay {
+		return
+	}
+	if h.Type == codec.MsgStream {
+		h.Type = codec.MsgStreamEnd
+	} else {
+		h.Type = codec.MsgCall
+	}
+	h.Metadata = nil
+	setError(&h, ErrUnauthenticated)
+	_ = cc.Write(&h, invalidRequest)
+}
+
+// 客户端在发送Option之后完成认证
+func clientAuthenticate(conn io.Writer, dec *json.Decoder, creds Credentials) error {
+	var challenge authChallenge
+	if err := dec.Decode(&challenge); err != nil {
+		return err
+	}
+	credential, err := creds.Credential(challenge.Challenge)
+	if err != nil {
+		return err
+	}
+	if err = json.NewEncoder(conn).Encode(&authCredential{Credential: credential}); err != nil {
+		return err
+	}
+	var result authResult
+	if err = dec.Decode(&result); err != nil {
+		return err
+	}
+	if result.Error != "" {
+		return serverError(&codec.Header{Error: result.Error, ErrorCode: uint32(result.Code)})
+	}
+	return nil
+}
+
+// PrincipalFromContext 在服务方法中返回通过认证的调用方身份，
+// 没有使用Authenticator认证时为通过验证的客户端证书的CommonName
+func PrincipalFromContext(ctx context.Context) (string, bool) {
+	c, ok := ConnFromContext(ctx)
+	if !ok || c.sc.peer.principal == "" {
+		return "", false
+	}
+	return c.sc.peer.principal, true
+}
+
+// TokenScheme 是静态token认证方式的名称
+const TokenScheme = "token"
+
+type tokenAuthenticator struct {
+	tokens map[string]string
+}
+
+// NewTokenAuthenticator 返回静态token认证， tokens的key为token， value为对应的调用方身份
+func NewTokenAuthenticator(tokens map[string]string) Authenticator {
+	return &tokenAuthenticator{tokens: tokens}
+}
+
+func (a *tokenAuthenticator) Scheme() string { return TokenScheme }
+
+func (a *tokenAuthenticator) Authenticate(_ []byte, credential string) (string, error) {
+	for token, principal := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(credential)) == 1 {
+			return principal, nil
+		}
+	}
+	return "", errors.New("invalid token")
+}
+
+// TokenCredentials 是静态token认证的客户端凭证
+type TokenCredentials string
+
+func (t TokenCredentials) Scheme() string { return TokenScheme }
+
+func (t TokenCredentials) Credential([]byte) (string, error) { return string(t), nil }
+
+// HMACScheme 是HMAC challenge/response认证方式的名称，
+// 客户端的凭证为“keyID:hex(HMAC-SHA256(secret, challenge))”， 密钥不会在网络上传输
+const HMACScheme = "hmac-sha256"
+
+type hmacAuthenticator struct {
+	keys map[string][]byte
+}
+
+// NewHMACAuthenticator 返回HMAC认证， keys的key为密钥ID， 同时也是调用方身份
+func NewHMACAuthenticator(keys map[string][]byte) Authenticator {
+	return &hmacAuthenticator{keys: keys}
+}
+
+func (a *hmacAuthenticator) Scheme() string { return HMACScheme }
+
+func (a *hmacAuthenticator) Authenticate(challenge []byte, credential string) (string, error) {
+	i := strings.LastIndex(credential, ":")
+	if i < 0 {
+		return "", errors.New("malformed hmac credential")
+	}
+	keyID := credential[:i]
+	sig, err := hex.DecodeString(credential[i+1:])
+	secret, ok := a.keys[keyID]
+	if err != nil || !ok || !hmac.Equal(sig, signChallenge(secret, challenge)) {
+		return "", errors.New("invalid hmac signature for key " + keyID)
+	}
+	return keyID, nil
+}
+
+// HMACCredentials 是HMAC认证的客户端凭证
+type HMACCredentials struct {
+	KeyID  string
+	Secret []byte
+}
+
+func (c *HMACCredentials) Scheme() string { return HMACScheme }
+
+func (c *HMACCredentials) Credential(challenge []byte) (string, error) {
+	return c.KeyID + ":" + hex.EncodeToString(signChallenge(c.Secret, challenge)), nil
+}
+
+func signChallenge(secret, challenge []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(challenge)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,128 @@
+package geerpc
+
+import (
+	"context"
+	"encoding/json"
+	"geerpc/codec"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+type Principal int
+
+func (p Principal) Get(ctx context.Context, _ int, reply *string) error {
+	*reply, _ = PrincipalFromContext(ctx)
+	return nil
+}
+
+func TestServer_SetAuthenticators(t *testing.T) {
+	t.Parallel()
+	server := NewServer()
+	var p Principal
+	_ = server.Register(&p)
+	server.SetAuthenticators(
+		NewTokenAuthenticator(map[string]string{"s3cret": "alice"}),
+		NewHMACAuthenticator(map[string][]byte{"bob": []byte("key")}),
+	)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	addr := l.Addr().String()
+
+	for _, creds := range []Credentials{TokenCredentials("s3cret"), &HMACCredentials{KeyID: "bob", Secret: []byte("key")}} {
+		client, err := Dial("tcp", addr, &Option{Credentials: creds})
+		_assert(err == nil, "failed to authenticate with %s: %v", creds.Scheme(), err)
+		var principal string
+		err = client.Call(context.Background(), "Principal.Get", 0, &principal)
+		_assert(err == nil && principal != "", "expect the principal with %s, got %q, %v", creds.Scheme(), principal, err)
+		_ = client.Close()
+	}
+
+	for _, creds := range []Credentials{TokenCredentials("wrong"), &HMACCredentials{KeyID: "bob", Secret: []byte("wrong")}} {
+		_, err := Dial("tcp", addr, &Option{Credentials: creds})
+		_assert(err == ErrUnauthenticated, "expect ErrUnauthenticated with %s, got %v", creds.Scheme(), err)
+	}
+
+	// a connection without credentials gets an error response
+	client, err := Dial("tcp", addr)
+	_assert(err == nil, "failed to dial: %v", err)
+	defer func() { _ = client.Close() }()
+	var principal string
+	err = client.Call(context.Background(), "Principal.Get", 0, &principal)
+	_assert(err == ErrUnauthenticated, "expect ErrUnauthenticated, got %v", err)
+}
+
+func TestClient_CredentialsWithoutAuth(t *testing.T) {
+	t.Parallel()
+	server := NewServer()
+	var p Principal
+	_ = server.Register(&p)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+
+	client, err := Dial("tcp", l.Addr().String(), &Option{Credentials: TokenCredentials("any")})
+	_assert(err == nil, "expect servers without authenticators to accept any credentials: %v", err)
+	defer func() { _ = client.Close() }()
+	principal := "unset"
+	err = client.Call(context.Background(), "Principal.Get", 0, &principal)
+	_assert(err == nil && principal == "", "expect no principal, got %q, %v", principal, err)
+}
+
+func TestNewClient_AuthTimeout(t *testing.T) {
+	t.Parallel()
+	// the server accepts the connection but never answers the handshake
+	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() { _, _ = io.Copy(ioutil.Discard, conn) }()
+		}
+	}()
+
+	opt := &Option{CodecType: codec.GobType, Credentials: TokenCredentials("s3cret"), ConnectTimeout: 100 * time.Millisecond}
+	conn, _ := net.Dial("tcp", l.Addr().String())
+	start := time.Now()
+	_, err := NewClient(conn, opt)
+	ne, ok := err.(net.Error)
+	_assert(ok && ne.Timeout() && time.Since(start) < time.Second, "expect the handshake to time out, got %v after %s", err, time.Since(start))
+	_assert(opt.AuthScheme == "", "expect the caller's Option to be left untouched, got %q", opt.AuthScheme)
+}
+
+func TestServer_AuthTimeout(t *testing.T) {
+	t.Parallel()
+	server := NewServer()
+	server.SetAuthenticators(NewTokenAuthenticator(map[string]string{"s3cret": "alice"}))
+	server.handshakeTimeout = 100 * time.Millisecond
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+
+	closed := func(conn net.Conn) bool {
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err := io.Copy(ioutil.Discard, conn)
+		return err == nil // io.Copy returns nil on EOF
+	}
+	// the client connects and never sends the Option
+	silent, _ := net.Dial("tcp", l.Addr().String())
+	defer func() { _ = silent.Close() }()
+	_assert(closed(silent), "expect the server to close a connection without the Option")
+
+	// the client asks for the challenge and never answers it
+	stalled, _ := net.Dial("tcp", l.Addr().String())
+	defer func() { _ = stalled.Close() }()
+	_ = json.NewEncoder(stalled).Encode(&Option{MagicNumber: MagicNumber, CodecType: codec.GobType, AuthScheme: TokenScheme})
+	_assert(closed(stalled), "expect the server to close a connection that doesn't authenticate")
+
+	// the deadline is cleared once the connection is authenticated
+	client, err := Dial("tcp", l.Addr().String(), &Option{Credentials: TokenCredentials("s3cret")})
+	_assert(err == nil, "failed to dial: %v", err)
+	defer func() { _ = client.Close() }()
+	time.Sleep(200 * time.Millisecond)
+	err = client.Call(context.Background(), "Health.Check", "", new(ServingStatus))
+	_assert(err == nil, "expect the connection to outlive the handshake timeout: %v", err)
+}
@@ -0,0 +1,108 @@
+package geerpc
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"strings"
+	"sync"
+)
+
+// ErrPermissionDenied 表示调用方没有调用这个方法的权限
+var ErrPermissionDenied error = NewError(CodePermissionDenied, "rpc server: permission denied")
+
+// Authorizer 决定调用方principal是否可以调用serviceMethod，
+// 没有通过认证的调用方principal为空， 使用mutual TLS时为客户端证书的CommonName
+type Authorizer interface {
+	Authorize(principal, serviceMethod string) bool
+}
+
+// SetAuthorizer 设置服务器的授权策略， 每个请求在执行之前都要经过它的检查，
+// 包括内置的Health服务和通过RegisterReflection注册的Reflection服务
+func (server *Server) SetAuthorizer(a Authorizer) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.authorizer = a
+}
+
+// authorize 检查连接上的调用方是否可以调用serviceMethod， 拒绝时记录日志
+func (server *Server) authorize(sc *serverConn, serviceMethod string) error {
+	server.mu.Lock()
+	a := server.authorizer
+	server.mu.Unlock()
+	if a == nil || a.Authorize(sc.peer.principal, serviceMethod) {
+		return nil
+	}
+	log.Printf("rpc server: permission denied: principal %q from %s calling %s", sc.peer.principal, sc.peer.remote, serviceMethod)
+	return ErrPermissionDenied
+}
+
+// ACL 是基于规则的Authorizer， 每条规则允许一个principal调用匹配的方法。
+// 方法的模式为“Service.Method”， 服务名和方法名都可以是“*”， 例如“Admin.*”；
+// 模式“*”匹配所有方法， principal为“*”的规则适用于所有调用方， 包括没有认证的调用方
+type ACL struct {
+	mu    sync.RWMutex
+	rules map[string][]string // principal -> patterns
+}
+
+// NewACL 返回一个空的ACL， 没有添加规则时拒绝所有调用
+func NewACL() *ACL {
+	return &ACL{rules: make(map[string][]string)}
+}
+
+// LoadACL 从JSON格式的策略文件中读取规则， 文件内容为principal到方法模式列表的映射：
+//
+//	{
+//		"alice": ["Admin.*"],
+//		"bob":   ["Foo.Sum", "Foo.Get"],
+//		"*":     ["Health.*"]
+//	}
+func LoadACL(path string) (*ACL, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules map[string][]string
+	if err = json.Unmarshal(data, &rules); err != nil {
+		return nil, errors.New("rpc: invalid acl policy " + path + ": " + err.Error())
+	}
+	acl := NewACL()
+	for principal, patterns := range rules {
+		acl.Allow(principal, patterns...)
+	}
+	return acl, nil
+}
+
+// Allow 允许principal调用匹配patterns的方法
+func (acl *ACL) Allow(principal string, patterns ...string) {
+	acl.mu.Lock()
+	defer acl.mu.Unlock()
+	acl.rules[principal] = append(acl.rules[principal], patterns...)
+}
+
+// Authorize implements Authorizer
+func (acl *ACL) Authorize(principal, serviceMethod string) bool {
+	acl.mu.RLock()
+	defer acl.mu.RUnlock()
+	for _, p := range []string{principal, "*"} {
+		for _, pattern := range acl.rules[p] {
+			if matchMethod(pattern, serviceMethod) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchMethod(pattern, serviceMethod string) bool {
+	if pattern == "*" || pattern == serviceMethod {
+		return true
+	}
+	i, j := strings.LastIndex(pattern, "."), strings.LastIndex(serviceMethod, ".")
+	if i < 0 || j < 0 {
+		return false
+	}
+	service, method := pattern[:i], pattern[i+1:]
+	return (service == "*" || service == serviceMethod[:j]) && (method == "*" || method == serviceMethod[j+1:])
+}
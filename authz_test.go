@@ -0,0 +1,79 @@
+package geerpc
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type Admin int
+
+func (a Admin) Reset(_ int, reply *int) error {
+	*reply = 0
+	return nil
+}
+
+func TestMatchMethod(t *testing.T) {
+	for _, c := range []struct {
+		pattern, serviceMethod string
+		match                  bool
+	}{
+		{"*", "Foo.Sum", true},
+		{"Foo.Sum", "Foo.Sum", true},
+		{"Foo.*", "Foo.Sum", true},
+		{"*.Sum", "Foo.Sum", true},
+		{"*.*", "Foo.Sum", true},
+		{"Foo.*", "Foobar.Sum", false},
+		{"Foo.Get", "Foo.Sum", false},
+		{"Foo", "Foo.Sum", false},
+	} {
+		_assert(matchMethod(c.pattern, c.serviceMethod) == c.match, "%s matching %s should be %v", c.pattern, c.serviceMethod, c.match)
+	}
+}
+
+func TestServer_SetAuthorizer(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "geerpc")
+	_assert(err == nil, "failed to create temp dir: %v", err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	policy := filepath.Join(dir, "acl.json")
+	_ = ioutil.WriteFile(policy, []byte(`{"alice": ["Admin.*"], "bob": ["Foo.Sum"], "*": ["Health.*"]}`), 0644)
+	acl, err := LoadACL(policy)
+	_assert(err == nil, "failed to load policy: %v", err)
+	acl.Allow("alice", "Foo.*")
+
+	server := NewServer()
+	var foo Foo
+	var admin Admin
+	_ = server.Register(&foo)
+	_ = server.Register(&admin)
+	server.SetAuthenticators(NewTokenAuthenticator(map[string]string{"a": "alice", "b": "bob"}))
+	server.SetAuthorizer(acl)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+
+	call := func(token, serviceMethod string) error {
+		client, err := Dial("tcp", l.Addr().String(), &Option{Credentials: TokenCredentials(token)})
+		_assert(err == nil, "failed to dial: %v", err)
+		defer func() { _ = client.Close() }()
+		var reply int
+		return client.Call(context.Background(), serviceMethod, Args{Num1: 1, Num2: 2}, &reply)
+	}
+	_assert(call("a", "Foo.Sum") == nil, "expect alice to call Foo.Sum")
+	_assert(call("b", "Foo.Sum") == nil, "expect bob to call Foo.Sum")
+	_assert(call("b", "Admin.Reset") == ErrPermissionDenied, "expect bob not to call Admin.Reset")
+	_assert(call("b", "Foo.Unknown") != ErrPermissionDenied, "expect a method not found error")
+
+	client, _ := Dial("tcp", l.Addr().String(), &Option{Credentials: TokenCredentials("b")})
+	defer func() { _ = client.Close() }()
+	status, err := client.HealthCheck(context.Background(), "Foo")
+	_assert(err == nil && status == StatusServing, "expect everyone to check health: %v", err)
+	var reply int
+	err = client.Call(context.Background(), "Admin.Reset", 1, &reply)
+	_assert(err == ErrPermissionDenied, "expect ErrPermissionDenied, got %v", err)
+	err = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "expect the connection to work after a denial: %v", err)
+}
@@ -8,13 +8,13 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"geerpc/codec"
 	"io"
 	"log"
 	"net"
 	"net/http"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
@@ -28,6 +28,10 @@ type Call struct {
 	Reply         interface{} // reply from the function
 	Error         error       // if error occurs, it will be set
 	Done          chan *Call  // Strobes when call is complete.
+	Metadata      Metadata    // metadata sent with the request
+	ReplyMetadata Metadata    // metadata returned by the server
+	// time left before the deadline of ctx, 0 means no deadline
+	timeout time.Duration
 }
 
 //  当调用done时代表有call完成并返回respond报文
@@ -49,13 +53,16 @@ type Client struct {
 	mu       sync.Mutex // protect following
 	seq      uint64
 	pending  map[uint64]*Call // 存入未返回的请求
+	streams  map[uint64]*ClientStream // 正在进行的流式调用
+	handlers map[string]reflect.Value // 服务端推送通知的处理函数， 以事件名为key
 	closing  bool // user has called Close
 	shutdown bool // server has told us to stop
 }
 
 var _ io.Closer = (*Client)(nil)
 
-var ErrShutdown = errors.New("connection is shut down")
+// ErrShutdown 表示连接已经关闭
+var ErrShutdown error = NewError(CodeUnavailable, "connection is shut down")
 
 // Close the connection
 func (client *Client) Close() error {
@@ -97,6 +104,13 @@ func (client *Client) removeCall(seq uint64) *Call {
 	return call
 }
 
+// 服务端通知即将关闭， 不再注册新的请求， IsAvailable返回false
+func (client *Client) goAway() {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.shutdown = true
+}
+
 // 终止所有请求
 func (client *Client) terminateCalls(err error) {
 	client.sending.Lock()
@@ -108,6 +122,10 @@ func (client *Client) terminateCalls(err error) {
 		call.Error = err
 		call.done()
 	}
+	for seq, s := range client.streams {
+		delete(client.streams, seq)
+		s.recv.finish(err)
+	}
 }
 
 // 发送请求 先注册请求然后发送请求
@@ -131,6 +149,8 @@ func (client *Client) send(call *Call) {// Client represents an RPC Client.
 	client.header.ServiceMethod = call.ServiceMethod
 	client.header.Seq = seq
 	client.header.Error = ""
+	client.header.Metadata = call.Metadata
+	client.header.Timeout = int64(call.timeout)
 
 	// encode and send the request
 	if err := client.cc.Write(&client.header, call.Args); err != nil {
@@ -144,6 +164,16 @@ func (client *Client) send(call *Call) {// Client represents an RPC Client.
 	}
 }
 
+// cancel 通知服务端放弃seq对应的请求， 服务端会取消服务方法的ctx
+func (client *Client) cancel(seq uint64) {
+	client.sending.Lock()
+	defer client.sending.Unlock()
+	h := &codec.Header{Seq: seq, Type: codec.MsgCancel}
+	if err := client.cc.Write(h, invalidRequest); err != nil {
+		log.Println("rpc client: send cancel error:", err)
+	}
+}
+
 func (client *Client) receive() {
 	var err error
 	for err == nil {
@@ -151,20 +181,39 @@ func (client *Client) receive() {
 		if err = client.cc.ReadHeader(&h); err != nil {
 			break
 		}
+		if h.Type == codec.MsgGoAway {
+			// the server is shutting down, pending calls will still be answered
+			err = client.cc.ReadBody(nil)
+			client.goAway()
+			continue
+		}
+		if h.Type == codec.MsgNotify {
+			err = client.dispatchNotification(&h)
+			continue
+		}
+		if isStreamMessage(h.Type) {
+			var ok bool
+			if ok, err = client.dispatchStream(&h); ok {
+				continue
+			}
+		}
 		call := client.removeCall(h.Seq)
+		if call != nil {
+			call.ReplyMetadata = h.Metadata
+		}
 		switch {
 		case call == nil:
 			// it usually means that Write partially failed
 			// and call was already removed.
 			err = client.cc.ReadBody(nil)
 		case h.Error != "":
-			call.Error = fmt.Errorf(h.Error)
+			call.Error = serverError(&h)
 			err = client.cc.ReadBody(nil)
 			call.done()
 		default:
 			err = client.cc.ReadBody(call.Reply)
 			if err != nil {
-				call.Error = errors.New("reading body " + err.Error())
+				call.Error = Errorf(CodeCodec, "reading body %v", err)
 			}
 			call.done()
 		}
@@ -173,46 +222,132 @@ func (client *Client) receive() {
 	client.terminateCalls(err)
 }
 
-// Go invokes the function asynchronously.
-// It returns the Call structure representing the invocation.
-func (client *Client) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+func newCall(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
 	if done == nil {
 		done = make(chan *Call, 10)
 	} else if cap(done) == 0 {
 		log.Panic("rpc client: done channel is unbuffered")
 	}
-	call := &Call{
+	return &Call{
 		ServiceMethod: serviceMethod,
 		Args:          args,
 		Reply:         reply,
 		Done:          done,
 	}
-	client.send(call)
+}
+
+// Go invokes the function asynchronously.
+// It returns the Call structure representing the invocation.
+func (client *Client) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+	call := newCall(serviceMethod, args, reply, done)
+	if len(client.opt.Interceptors) == 0 {
+		client.send(call)
+		return call
+	}
+	// interceptors wait for the result, so run them in background
+	go func() {
+		ctx := WithReplyMetadata(context.Background(), &call.ReplyMetadata)
+		call.Error = client.Call(ctx, serviceMethod, args, reply)
+		call.done()
+	}()
 	return call
 }
 
 // Call invokes the named function, waits for it to complete,
 // and returns its error status.
+// Metadata attached by NewOutgoingContext is sent with the request,
+// the reply metadata is stored into the target of WithReplyMetadata.
+// The call goes through the interceptors in Option.Interceptors.
 func (client *Client) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
-	call := client.Go(serviceMethod, args, reply, make(chan *Call, 1))
+	if len(client.opt.Interceptors) == 0 {
+		return client.call(ctx, serviceMethod, args, reply)
+	}
+	return chainClientInterceptors(client.opt.Interceptors, client.call)(ctx, serviceMethod, args, reply)
+}
+
+func (client *Client) call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	// the server stops handling the request once the deadline is exceeded
+	timeout, err := requestTimeout(ctx)
+	if err != nil {
+		return err
+	}
+	call := newCall(serviceMethod, args, reply, make(chan *Call, 1))
+	call.Metadata, _ = FromOutgoingContext(ctx)
+	call.timeout = timeout
+	client.send(call)
 	select {
 	case <-ctx.Done():
-		client.removeCall(call.Seq)
-		return errors.New("rpc client: call failed: " + ctx.Err().Error())
+		if client.removeCall(call.Seq) != nil {
+			// the request is still running on the server, tell it to stop
+			client.cancel(call.Seq)
+		}
+		return callError(ctx.Err())
 	case call := <-call.Done:
+		if md, ok := ctx.Value(replySinkKey{}).(*Metadata); ok {
+			*md = call.ReplyMetadata
+		}
 		return call.Error
 	}
 }
 
+// CallOneWay sends a request that expects no reply and returns once it is written.
+// No pending call is registered, errors of the service method are only logged by the server.
+// The call goes through the interceptors in Option.Interceptors with a nil reply.
+func (client *Client) CallOneWay(ctx context.Context, serviceMethod string, args interface{}) error {
+	if len(client.opt.Interceptors) == 0 {
+		return client.oneWay(ctx, serviceMethod, args, nil)
+	}
+	return chainClientInterceptors(client.opt.Interceptors, client.oneWay)(ctx, serviceMethod, args, nil)
+}
+
+func (client *Client) oneWay(ctx context.Context, serviceMethod string, args, _ interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return callError(err)
+	}
+	timeout, err := requestTimeout(ctx)
+	if err != nil {
+		return err
+	}
+	client.mu.Lock()
+	if client.closing || client.shutdown {
+		client.mu.Unlock()
+		return ErrShutdown
+	}
+	// still take a seq, so the server can tell concurrent requests apart
+	seq := client.seq
+	client.seq++
+	client.mu.Unlock()
+	h := &codec.Header{ServiceMethod: serviceMethod, Seq: seq, Type: codec.MsgOneWay}
+	h.Metadata, _ = FromOutgoingContext(ctx)
+	h.Timeout = int64(timeout)
+	return client.write(h, args)
+}
+
+// requestTimeout 返回ctx的deadline剩余的时间， 0表示没有deadline。
+// 服务端把Timeout为0视为不限制， 所以deadline已经过去时直接返回错误， 不发送请求
+func requestTimeout(ctx context.Context) (time.Duration, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, nil
+	}
+	timeout := time.Until(deadline)
+	if timeout <= 0 {
+		return 0, callError(context.DeadlineExceeded)
+	}
+	return timeout, nil
+}
+
 func parseOptions(opts ...*Option) (*Option, error) {
 	// if opts is nil or pass nil as parameter
 	if len(opts) == 0 || opts[0] == nil {
 		return DefaultOption, nil
 	}
 	if len(opts) != 1 {
-		return nil, errors.New("number of options is more than 1")
+		return nil, NewError(CodeInvalidArgument, "number of options is more than 1")
 	}
-	opt := opts[0]
+	// 复制一份， 同一个Option可能被多个连接同时使用
+	o := *opts[0]
+	opt := &o
 	opt.MagicNumber = DefaultOption.MagicNumber
 	if opt.CodecType == "" {
 		opt.CodecType = DefaultOption.CodecType
@@ -221,19 +356,39 @@ func parseOptions(opts ...*Option) (*Option, error) {
 }
 
 func NewClient(conn net.Conn, opt *Option) (*Client, error) {
-	f := codec.NewCodecFuncMap[opt.CodecType]
-	if f == nil {
-		err := fmt.Errorf("invalid codec type %s", opt.CodecType)
+	f, err := opt.newCodecFunc()
+	if err != nil {
 		log.Println("rpc client: codec error:", err)
 		return nil, err
 	}
+	if opt.Credentials != nil {
+		// 不修改调用方的Option， XClient的所有连接共用同一个Option
+		o := *opt
+		o.AuthScheme = o.Credentials.Scheme()
+		opt = &o
+	}
+	// 发送Option和认证都必须在ConnectTimeout内完成， 避免服务端没有响应时一直阻塞
+	if opt.ConnectTimeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(opt.ConnectTimeout))
+	}
 	// send options with server
 	if err := json.NewEncoder(conn).Encode(opt); err != nil {
 		log.Println("rpc client: options error: ", err)
 		_ = conn.Close()
 		return nil, err
 	}
-	return newClientCodec(f(conn), opt), nil
+	if opt.Credentials == nil {
+		_ = conn.SetDeadline(time.Time{})
+		return newClientCodec(f(conn), opt), nil
+	}
+	dec := json.NewDecoder(conn)
+	if err := clientAuthenticate(conn, dec, opt.Credentials); err != nil {
+		log.Println("rpc client: authentication error:", err)
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return newClientCodec(f(newBufferedConn(conn, dec)), opt), nil
 }
 
 func newClientCodec(cc codec.Codec, opt *Option) *Client {
@@ -242,6 +397,7 @@ func newClientCodec(cc codec.Codec, opt *Option) *Client {
 		cc:      cc,
 		opt:     opt,
 		pending: make(map[uint64]*Call),
+		streams: make(map[uint64]*ClientStream),
 	}
 	go client.receive()
 	return client
@@ -259,7 +415,7 @@ func dialTimeout(f newClientFunc, network, address string, opts ...*Option) (cli
 	if err != nil {
 		return nil, err
 	}
-	conn, err := net.DialTimeout(network, address, opt.ConnectTimeout)
+	conn, err := dialConn(network, address, opt)
 	if err != nil {
 		return nil, err
 	}
@@ -280,7 +436,7 @@ func dialTimeout(f newClientFunc, network, address string, opts ...*Option) (cli
 	}
 	select {
 	case <-time.After(opt.ConnectTimeout):
-		return nil, fmt.Errorf("rpc client: connect timeout: expect within %s", opt.ConnectTimeout)
+		return nil, Errorf(CodeDeadlineExceeded, "rpc client: connect timeout: expect within %s", opt.ConnectTimeout)
 	case result := <-ch:
 		return result.client, result.err
 	}
@@ -302,7 +458,7 @@ func NewHTTPClient(conn net.Conn, opt *Option) (*Client, error) {
 		return NewClient(conn, opt)
 	}
 	if err == nil {
-		err = errors.New("unexpected HTTP response: " + resp.Status)
+		err = NewError(CodeUnavailable, "unexpected HTTP response: "+resp.Status)
 	}
 	return nil, err
 }
@@ -316,16 +472,18 @@ func DialHTTP(network, address string, opts ...*Option) (*Client, error) {
 // XDial calls different functions to connect to a RPC server
 // according the first parameter rpcAddr.
 // rpcAddr is a general format (protocol@addr) to represent a rpc server
-// eg, http@10.0.0.1:7001, tcp@10.0.0.1:9999, unix@/tmp/geerpc.sock
+// eg, http@10.0.0.1:7001, tcp@10.0.0.1:9999, tls@10.0.0.1:9999, unix@/tmp/geerpc.sock
 func XDial(rpcAddr string, opts ...*Option) (*Client, error) {
 	parts := strings.Split(rpcAddr, "@")
 	if len(parts) != 2 {
-		return nil, fmt.Errorf("rpc client err: wrong format '%s', expect protocol@addr", rpcAddr)
+		return nil, Errorf(CodeInvalidArgument, "rpc client err: wrong format '%s', expect protocol@addr", rpcAddr)
 	}
 	protocol, addr := parts[0], parts[1]
 	switch protocol {
 	case "http":
 		return DialHTTP("tcp", addr, opts...)
+	case "tls":
+		return DialTLS("tcp", addr, opts...)
 	default:
 		// tcp, unix or other transport protocol
 		return Dial(protocol, addr, opts...)
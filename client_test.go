@@ -1,13 +1,19 @@
 package geerpc
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"geerpc/codec"
 	"net"
 	"os"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 type Bar int
@@ -86,3 +92,234 @@ func TestXDial(t *testing.T) {
 		_assert(err == nil, "failed to connect unix socket")
 	}
 }
+
+type Greeter int
+
+func (g Greeter) Hello(ctx context.Context, name string, reply *string) error {
+	md, _ := FromIncomingContext(ctx)
+	*reply = md["greeting"] + ", " + name
+	return SetReplyMetadata(ctx, Metadata{"served-by": "greeter"})
+}
+
+func TestClient_CodecType(t *testing.T) {
+	t.Parallel()
+	var foo Foo
+	var greeter Greeter
+	server := NewServer()
+	_ = server.Register(&foo)
+	_ = server.Register(&greeter)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	for _, typ := range []codec.Type{codec.GobType, codec.JsonType, codec.BinaryType, codec.MsgpackType} {
+		t.Run(string(typ), func(t *testing.T) {
+			client, err := Dial("tcp", l.Addr().String(), &Option{CodecType: typ})
+			_assert(err == nil, "failed to dial with %s: %v", typ, err)
+			defer func() { _ = client.Close() }()
+			for i := 0; i < 3; i++ {
+				var reply int
+				err = client.Call(context.Background(), "Foo.Sum", &Args{Num1: i, Num2: i * i}, &reply)
+				_assert(err == nil && reply == i+i*i, "failed to call Foo.Sum with %s: %v", typ, err)
+			}
+			// the body of an unknown method must be skipped without breaking the connection
+			var reply int
+			err = client.Call(context.Background(), "Foo.Unknown", &Args{Num1: 1, Num2: 2}, &reply)
+			_assert(err != nil && strings.Contains(err.Error(), "can't find method"), "expect a method not found error")
+			err = client.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+			_assert(err == nil && reply == 3, "connection broken after unknown method with %s: %v", typ, err)
+			// metadata travels in both directions
+			var greeting string
+			var md Metadata
+			ctx := NewOutgoingContext(context.Background(), Metadata{"greeting": "hello"})
+			err = client.Call(WithReplyMetadata(ctx, &md), "Greeter.Hello", "gee", &greeting)
+			_assert(err == nil && greeting == "hello, gee", "failed to call Greeter.Hello with %s: %v", typ, err)
+			_assert(md["served-by"] == "greeter", "failed to receive reply metadata with %s", typ)
+		})
+	}
+}
+
+type Echo int
+
+func (e Echo) Upper(args *wrapperspb.StringValue, reply *wrapperspb.StringValue) error {
+	reply.Value = strings.ToUpper(args.Value)
+	return nil
+}
+
+func TestClient_Protobuf(t *testing.T) {
+	t.Parallel()
+	var echo Echo
+	server := NewServer()
+	_ = server.Register(&echo)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	client, err := Dial("tcp", l.Addr().String(), &Option{CodecType: codec.ProtobufType})
+	_assert(err == nil, "failed to dial: %v", err)
+	defer func() { _ = client.Close() }()
+
+	reply := &wrapperspb.StringValue{}
+	err = client.Call(context.Background(), "Echo.Upper", wrapperspb.String("gee"), reply)
+	_assert(err == nil && reply.Value == "GEE", "failed to call Echo.Upper: %v", err)
+	err = client.Call(context.Background(), "Echo.Upper", "gee", reply)
+	_assert(err != nil && strings.Contains(err.Error(), "proto.Message"), "expect a proto.Message error")
+	err = client.Call(context.Background(), "Echo.Unknown", wrapperspb.String("gee"), reply)
+	_assert(err != nil && strings.Contains(err.Error(), "can't find method"), "expect a method not found error")
+}
+
+type Blob int
+
+func (b Blob) Fill(n int, reply *[]byte) error {
+	*reply = bytes.Repeat([]byte("gee"), n)
+	return nil
+}
+
+func TestClient_Compression(t *testing.T) {
+	t.Parallel()
+	var blob Blob
+	server := NewServer()
+	_ = server.Register(&blob)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	for _, c := range []codec.Compression{codec.GzipCompression, codec.SnappyCompression, codec.ZstdCompression} {
+		t.Run(string(c), func(t *testing.T) {
+			client, err := Dial("tcp", l.Addr().String(), &Option{CodecType: codec.JsonType, Compression: c})
+			_assert(err == nil, "failed to dial with %s: %v", c, err)
+			defer func() { _ = client.Close() }()
+			// small messages are sent as is, large ones are compressed
+			for _, n := range []int{1, 10000} {
+				var reply []byte
+				err = client.Call(context.Background(), "Blob.Fill", n, &reply)
+				_assert(err == nil && len(reply) == 3*n, "failed to call Blob.Fill with %s: %v", c, err)
+			}
+		})
+	}
+	_, err := Dial("tcp", l.Addr().String(), &Option{Compression: "lz4"})
+	_assert(err != nil && strings.Contains(err.Error(), "unsupported compression"), "expect an unsupported compression error")
+}
+
+type Waiter struct{ canceled chan error }
+
+func (w *Waiter) Wait(ctx context.Context, argv int, reply *int) error {
+	<-ctx.Done()
+	w.canceled <- ctx.Err()
+	return ctx.Err()
+}
+
+func TestServer_CancelContext(t *testing.T) {
+	t.Parallel()
+	waiter := &Waiter{canceled: make(chan error, 1)}
+	server := NewServer()
+	_ = server.Register(waiter)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+
+	t.Run("handle timeout", func(t *testing.T) {
+		client, _ := Dial("tcp", l.Addr().String(), &Option{HandleTimeout: time.Second})
+		defer func() { _ = client.Close() }()
+		var reply int
+		err := client.Call(context.Background(), "Waiter.Wait", 1, &reply)
+		_assert(err == ErrDeadlineExceeded, "expect ErrDeadlineExceeded, but got %v", err)
+		_assert(<-waiter.canceled == context.DeadlineExceeded, "expect the method ctx to be timed out")
+	})
+	t.Run("client deadline", func(t *testing.T) {
+		client, _ := Dial("tcp", l.Addr().String(), &Option{HandleTimeout: time.Minute})
+		defer func() { _ = client.Close() }()
+		// the deadline carried in the header is shorter than HandleTimeout
+		call := newCall("Waiter.Wait", 1, new(int), nil)
+		call.timeout = time.Millisecond * 100
+		client.send(call)
+		<-call.Done
+		_assert(call.Error == ErrDeadlineExceeded, "expect ErrDeadlineExceeded, but got %v", call.Error)
+		_assert(<-waiter.canceled == context.DeadlineExceeded, "expect the method ctx to be timed out")
+	})
+	t.Run("client canceled", func(t *testing.T) {
+		client, _ := Dial("tcp", l.Addr().String())
+		defer func() { _ = client.Close() }()
+		// the connection is still usable after cancellation
+		for i := 0; i < 2; i++ {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(time.Millisecond*100, cancel)
+			var reply int
+			err := client.Call(ctx, "Waiter.Wait", 1, &reply)
+			_assert(err != nil && strings.Contains(err.Error(), context.Canceled.Error()), "expect a canceled error")
+			_assert(<-waiter.canceled == context.Canceled, "expect the method ctx to be canceled")
+		}
+	})
+	t.Run("canceled right after sending", func(t *testing.T) {
+		client, _ := Dial("tcp", l.Addr().String())
+		defer func() { _ = client.Close() }()
+		// the cancel message may arrive before the request is handled
+		call := newCall("Waiter.Wait", 1, new(int), nil)
+		client.send(call)
+		client.cancel(call.Seq)
+		select {
+		case err := <-waiter.canceled:
+			_assert(err == context.Canceled, "expect the method ctx to be canceled, but got %v", err)
+		case <-time.After(time.Second):
+			t.Fatal("the cancel message was lost")
+		}
+		<-call.Done
+	})
+	t.Run("connection closed", func(t *testing.T) {
+		client, _ := Dial("tcp", l.Addr().String())
+		call := client.Go("Waiter.Wait", 1, new(int), nil)
+		time.Sleep(time.Millisecond * 100)
+		_ = client.Close()
+		<-call.Done
+		_assert(<-waiter.canceled == context.Canceled, "expect the method ctx to be canceled")
+	})
+}
+
+type Flaky struct{ calls int32 }
+
+// Hello fails every other call
+func (f *Flaky) Hello(ctx context.Context, name string, reply *string) error {
+	if atomic.AddInt32(&f.calls, 1)%2 == 1 {
+		return errors.New("try again")
+	}
+	md, _ := FromIncomingContext(ctx)
+	*reply = md["greeting"] + ", " + name
+	return nil
+}
+
+func TestClient_Interceptors(t *testing.T) {
+	t.Parallel()
+	server := NewServer()
+	_ = server.Register(&Flaky{})
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+
+	var attempts int32
+	retry := func(ctx context.Context, serviceMethod string, args, reply interface{}, invoker Invoker) error {
+		err := invoker(ctx, serviceMethod, args, reply)
+		for i := 0; err != nil && i < 2; i++ {
+			err = invoker(ctx, serviceMethod, args, reply)
+		}
+		return err
+	}
+	greet := func(ctx context.Context, serviceMethod string, args, reply interface{}, invoker Invoker) error {
+		atomic.AddInt32(&attempts, 1)
+		return invoker(NewOutgoingContext(ctx, Metadata{"greeting": "hello"}), serviceMethod, args, reply)
+	}
+	client, _ := Dial("tcp", l.Addr().String(), &Option{Interceptors: []ClientInterceptor{retry, greet}})
+	defer func() { _ = client.Close() }()
+
+	var reply string
+	err := client.Call(context.Background(), "Flaky.Hello", "gee", &reply)
+	_assert(err == nil && reply == "hello, gee", "expect the call to be retried, but got %q, %v", reply, err)
+	_assert(atomic.LoadInt32(&attempts) == 2, "expect 2 attempts, but got %d", attempts)
+	call := <-client.Go("Flaky.Hello", "go", &reply, nil).Done
+	_assert(call.Error == nil && reply == "hello, go", "expect Go to run interceptors, but got %q, %v", reply, call.Error)
+}
+
+func TestRequestTimeout(t *testing.T) {
+	timeout, err := requestTimeout(context.Background())
+	_assert(timeout == 0 && err == nil, "expect no timeout without a deadline")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	timeout, err = requestTimeout(ctx)
+	_assert(timeout > 0 && err == nil, "expect a positive timeout, got %v, %v", timeout, err)
+	// an expired deadline must not be sent as 0, which means no limit on the server
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = requestTimeout(expired)
+	_assert(ErrorCode(err) == CodeDeadlineExceeded, "expect a deadline error, got %v", err)
+}
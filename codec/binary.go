@@ -0,0 +1,313 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+)
+
+// 帧格式， 所有整数均为大端序
+//
+//	| magic(2) | flags(2) | header length(4) | body length(4) | header | body |
+//
+// header 为紧凑编码的 Header， body 为独立编码的消息体，
+// 读取方无需解码 body 即可跳过整帧， 代理也可以只解析 header 完成路由
+const (
+	FrameMagic      uint16 = 0x6765 // "ge"
+	frameHeaderSize        = 12
+	MaxFrameSize           = 16 << 20 // header 与 body 的长度上限， 防止异常长度耗尽内存
+)
+
+var (
+	ErrInvalidMagic  = errors.New("codec: invalid frame magic")
+	ErrFrameTooLarge = errors.New("codec: frame too large")
+)
+
+// Frame 是二进制编解码在连接上传输的一帧
+type Frame struct {
+	Flags  uint16
+	Header []byte // 紧凑编码的 Header， 使用 DecodeHeader 解码
+	Body   []byte // 消息体， 对帧本身不透明
+}
+
+// ReadFrame 从 r 中读取完整的一帧
+func ReadFrame(r io.Reader) (*Frame, error) {
+	var prefix [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint16(prefix[0:2]) != FrameMagic {
+		return nil, ErrInvalidMagic
+	}
+	headerLen := binary.BigEndian.Uint32(prefix[4:8])
+	bodyLen := binary.BigEndian.Uint32(prefix[8:12])
+	if uint64(headerLen)+uint64(bodyLen) > MaxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+	f := &Frame{
+		Flags:  binary.BigEndian.Uint16(prefix[2:4]),
+		Header: make([]byte, headerLen),
+		Body:   make([]byte, bodyLen),
+	}
+	if _, err := io.ReadFull(r, f.Header); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if _, err := io.ReadFull(r, f.Body); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return f, nil
+}
+
+// WriteFrame 将一帧写入 w
+func WriteFrame(w io.Writer, f *Frame) error {
+	if uint64(len(f.Header))+uint64(len(f.Body)) > MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	var prefix [frameHeaderSize]byte
+	binary.BigEndian.PutUint16(prefix[0:2], FrameMagic)
+	binary.BigEndian.PutUint16(prefix[2:4], f.Flags)
+	binary.BigEndian.PutUint32(prefix[4:8], uint32(len(f.Header)))
+	binary.BigEndian.PutUint32(prefix[8:12], uint32(len(f.Body)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(f.Header); err != nil {
+		return err
+	}
+	_, err := w.Write(f.Body)
+	return err
+}
+
+// 帧已经开始读取， 此时的EOF说明帧被截断
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Header 的紧凑编码： 每个字段由 uvarint(字段号<<3 | 线类型) 开始，
+// 线类型为 varint 时紧跟一个 uvarint， 为 bytes 时紧跟 uvarint 长度和数据。
+// 解码时跳过未知字段， 以便后续为 Header 增加字段
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+const (
+	fieldServiceMethod = 1
+	fieldSeq           = 2
+	fieldError         = 3
+	fieldMetadata      = 4 // 每个键值对为一个bytes字段， 内部为字段1（key）和字段2（value）
+	fieldType          = 5
+	fieldTimeout       = 6
+	fieldErrorCode     = 7
+	fieldErrorDetails  = 8 // 与fieldMetadata的编码相同
+)
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(b, tmp[:n]...)
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	b = appendUvarint(b, uint64(field)<<3|wireVarint)
+	return appendUvarint(b, v)
+}
+
+func appendStringField(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = appendUvarint(b, uint64(field)<<3|wireBytes)
+	b = appendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// EncodeHeader 将 h 紧凑编码后追加到 b 中
+func EncodeHeader(b []byte, h *Header) []byte {
+	b = appendStringField(b, fieldServiceMethod, h.ServiceMethod)
+	b = appendVarintField(b, fieldSeq, h.Seq)
+	b = appendStringField(b, fieldError, h.Error)
+	if h.Type != MsgCall {
+		b = appendVarintField(b, fieldType, uint64(h.Type))
+	}
+	if h.Timeout > 0 {
+		b = appendVarintField(b, fieldTimeout, uint64(h.Timeout))
+	}
+	if h.ErrorCode != 0 {
+		b = appendVarintField(b, fieldErrorCode, uint64(h.ErrorCode))
+	}
+	b = appendMapField(b, fieldMetadata, h.Metadata)
+	return appendMapField(b, fieldErrorDetails, h.ErrorDetails)
+}
+
+// appendMapField 将m的每个键值对编码为一个bytes字段
+func appendMapField(b []byte, field int, m map[string]string) []byte {
+	for k, v := range m {
+		entry := appendStringField(appendStringField(nil, 1, k), 2, v)
+		b = appendUvarint(b, uint64(field)<<3|wireBytes)
+		b = appendUvarint(b, uint64(len(entry)))
+		b = append(b, entry...)
+	}
+	return b
+}
+
+var errMalformedHeader = errors.New("codec: malformed frame header")
+
+// rangeFields 依次解析b中的每个字段， varint字段的值在v中， bytes字段的值在data中
+func rangeFields(b []byte, fn func(field int, v uint64, data []byte)) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errMalformedHeader
+		}
+		b = b[n:]
+		field, wire := int(key>>3), key&7
+		switch wire {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return errMalformedHeader
+			}
+			b = b[n:]
+			fn(field, v, nil)
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || l > uint64(len(b)-n) {
+				return errMalformedHeader
+			}
+			fn(field, 0, b[n:n+int(l)])
+			b = b[n+int(l):]
+		default:
+			return fmt.Errorf("codec: unknown wire type %d in frame header", wire)
+		}
+	}
+	return nil
+}
+
+// DecodeHeader 解码由 EncodeHeader 编码的消息头， 未知字段会被跳过
+func DecodeHeader(b []byte, h *Header) error {
+	*h = Header{}
+	var err error
+	parseErr := rangeFields(b, func(field int, v uint64, data []byte) {
+		switch field {
+		case fieldServiceMethod:
+			h.ServiceMethod = string(data)
+		case fieldSeq:
+			h.Seq = v
+		case fieldError:
+			h.Error = string(data)
+		case fieldType:
+			h.Type = MessageType(v)
+		case fieldTimeout:
+			h.Timeout = int64(v)
+		case fieldErrorCode:
+			h.ErrorCode = uint32(v)
+		case fieldMetadata:
+			if e := decodeMapEntry(data, &h.Metadata); e != nil {
+				err = e
+			}
+		case fieldErrorDetails:
+			if e := decodeMapEntry(data, &h.ErrorDetails); e != nil {
+				err = e
+			}
+		}
+	})
+	if parseErr != nil {
+		return parseErr
+	}
+	return err
+}
+
+// decodeMapEntry 解码一个键值对字段并加入*m， *m为nil时先创建
+func decodeMapEntry(data []byte, m *map[string]string) error {
+	var key, value string
+	if err := rangeFields(data, func(field int, _ uint64, data []byte) {
+		switch field {
+		case 1:
+			key = string(data)
+		case 2:
+			value = string(data)
+		}
+	}); err != nil {
+		return err
+	}
+	if *m == nil {
+		*m = make(map[string]string)
+	}
+	(*m)[key] = value
+	return nil
+}
+
+// 二进制分帧编解码方法类
+// 消息体使用独立的gob编码， 每一帧都可以单独解码或丢弃， 不依赖连接上之前的消息
+type BinaryCodec struct {
+	conn io.ReadWriteCloser //conn连接， 通过tcp链接传输编码和解码消息
+	r    *bufio.Reader      //读缓冲区
+	buf  *bufio.Writer      //消息缓冲区， 通过buf.flush（）将缓冲区中消息发出
+	body []byte             //ReadHeader读出的帧中尚未解码的消息体
+}
+
+var _ Codec = (*BinaryCodec)(nil)
+
+// 二进制编解码类初始化函数
+func NewBinaryCodec(conn io.ReadWriteCloser) Codec {
+	return &BinaryCodec{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		buf:  bufio.NewWriter(conn),
+	}
+}
+
+// 读取一整帧并解码消息头， 消息体留给ReadBody
+func (c *BinaryCodec) ReadHeader(h *Header) error {
+	f, err := ReadFrame(c.r)
+	if err != nil {
+		return err
+	}
+	c.body = f.Body
+	return DecodeHeader(f.Header, h)
+}
+
+// 消息体解码 body为nil时直接丢弃
+func (c *BinaryCodec) ReadBody(body interface{}) error {
+	b := c.body
+	c.body = nil
+	if body == nil {
+		return nil
+	}
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(body)
+}
+
+// 写消息到conn中
+func (c *BinaryCodec) Write(h *Header, body interface{}) (err error) {
+	defer func() {
+		_ = c.buf.Flush()
+		if err != nil {
+			_ = c.Close()
+		}
+	}()
+	var b bytes.Buffer
+	if err = gob.NewEncoder(&b).Encode(body); err != nil {
+		log.Println("rpc: binary error encoding body:", err)
+		return
+	}
+	f := &Frame{Header: EncodeHeader(nil, h), Body: b.Bytes()}
+	if err = WriteFrame(c.buf, f); err != nil {
+		log.Println("rpc: binary error writing frame:", err)
+		return
+	}
+	return
+}
+
+// 关闭conn连接 conn.close（）
+func (c *BinaryCodec) Close() error {
+	return c.conn.Close()
+}
@@ -1,6 +1,7 @@
 package codec
 
 import (
+	"errors"
 	"io"
 )
 
@@ -9,8 +10,29 @@ type Header struct {
 	ServiceMethod string // 格式“Service.Method”
 	Seq           uint64 // 消息序列号
 	Error         string
+	Metadata      map[string]string // 请求/响应携带的元数据， 如trace id、认证信息等
+	Type          MessageType       // 消息类型， 普通的请求和响应为MsgCall
+	Timeout       int64             // 请求剩余的处理时间（纳秒）， 由客户端ctx的deadline换算得到， 0表示不限制
+	ErrorCode     uint32            // Error对应的错误码， 0表示没有错误码
+	ErrorDetails  map[string]string // 错误的附加信息
 }
 
+//消息类型， 用于在请求和响应之外传输控制消息
+type MessageType uint8
+
+const (
+	MsgCall   MessageType = iota // 普通的请求与响应
+	MsgCancel                    // 客户端放弃了Seq对应的请求， 消息体为空
+	MsgGoAway                    // 服务端即将关闭， 客户端不应再发送新的请求， 消息体为空
+
+	MsgStream       // 流式调用中的一条消息， 客户端发送的第一条消息携带ServiceMethod， 开启一个流
+	MsgStreamEnd    // 发送方不再发送消息， 服务端发送时表示流结束， Error不为空表示流以错误结束， 消息体为空
+	MsgWindowUpdate // 接收方为发送方增加流的发送额度， 消息体为空
+
+	MsgOneWay // 不需要响应的请求， 服务端处理后不发送任何消息
+	MsgNotify // 服务端主动推送的通知， ServiceMethod为事件名， Seq为0
+)
+
 //编码接口类
 //实现了readheader 对消息头解码 readbody对消息体解码 和写消息
 type Codec interface {
@@ -20,13 +42,19 @@ type Codec interface {
 	Write(*Header, interface{}) error //写消息
 }
 
+//ErrBodyType 表示编解码类型不支持消息体的类型， Write返回这个错误时没有向连接写入任何数据， 连接仍然可以使用
+var ErrBodyType = errors.New("codec: unsupported body type")
+
 type NewCodecFunc func(io.ReadWriteCloser) Codec
 
 type Type string
 
 const (
-	GobType  Type = "application/gob"
-	JsonType Type = "application/json" // not implemented
+	GobType      Type = "application/gob"
+	JsonType     Type = "application/json"
+	BinaryType   Type = "application/x-geerpc-frame" // 定长帧头 + 紧凑消息头 + 不透明消息体
+	ProtobufType Type = "application/protobuf"       // 参数和返回值需实现proto.Message
+	MsgpackType  Type = "application/msgpack"
 )
 
 //新建一个解码方法map  key为编解码方法，value为创建一个编解码方法类型
@@ -35,4 +63,8 @@ var NewCodecFuncMap map[Type]NewCodecFunc
 func init() {
 	NewCodecFuncMap = make(map[Type]NewCodecFunc)
 	NewCodecFuncMap[GobType] = NewGobCodec
+	NewCodecFuncMap[JsonType] = NewJsonCodec
+	NewCodecFuncMap[BinaryType] = NewBinaryCodec
+	NewCodecFuncMap[ProtobufType] = NewProtobufCodec
+	NewCodecFuncMap[MsgpackType] = NewMsgpackCodec
 }
@@ -0,0 +1,79 @@
+package codec
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestEncodeHeader(t *testing.T) {
+	h := Header{ServiceMethod: "Foo.Sum", Seq: 42, Error: "boom", Metadata: map[string]string{"trace-id": "1", "empty": ""}, Type: MsgCancel, Timeout: 1000, ErrorCode: 5, ErrorDetails: map[string]string{"service": "Foo"}}
+	b := EncodeHeader(nil, &h)
+	// an unknown field appended by a newer peer must be skipped
+	b = appendStringField(b, 15, "future")
+	var got Header
+	if err := DecodeHeader(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, h) {
+		t.Fatalf("expect %+v, but got %+v", h, got)
+	}
+	if err := DecodeHeader(b[:len(b)-1], &got); err == nil {
+		t.Fatal("expect an error for truncated header")
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	var buf bytes.Buffer
+	f := &Frame{Flags: 1, Header: []byte("header"), Body: []byte("body")}
+	if err := WriteFrame(&buf, f); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadFrame(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Flags != f.Flags || string(got.Header) != "header" || string(got.Body) != "body" {
+		t.Fatalf("expect %+v, but got %+v", f, got)
+	}
+	if _, err := ReadFrame(bytes.NewReader([]byte("GET / HTTP/1.0\r\n"))); err != ErrInvalidMagic {
+		t.Fatalf("expect ErrInvalidMagic, but got %v", err)
+	}
+}
+
+func TestProtoHeader(t *testing.T) {
+	h := Header{ServiceMethod: "Foo.Sum", Seq: 42, Error: "boom", Metadata: map[string]string{"trace-id": "1"}, Type: MsgCancel, Timeout: 1000, ErrorCode: 5, ErrorDetails: map[string]string{"service": "Foo"}}
+	var got Header
+	if err := unmarshalProtoHeader(marshalProtoHeader(&h), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, h) {
+		t.Fatalf("expect %+v, but got %+v", h, got)
+	}
+}
+
+func TestCompressionClose(t *testing.T) {
+	if _, err := WithCompression(NewGobCodec, "lz4", 0); err == nil {
+		t.Fatal("expect an unsupported compression error")
+	}
+	f, err := WithCompression(NewGobCodec, ZstdCompression, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		c1, c2 := net.Pipe()
+		_ = f(c1).Close()
+		_ = c2.Close()
+	}
+	// the zstd encoder and decoder goroutines exit once the codec is closed
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Fatalf("expect no leaked goroutines, got %d, was %d", n, before)
+	}
+}
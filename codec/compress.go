@@ -0,0 +1,305 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// 压缩算法， 在Option握手阶段由客户端指定
+type Compression string
+
+const (
+	NoCompression     Compression = ""
+	GzipCompression   Compression = "gzip"
+	SnappyCompression Compression = "snappy"
+	ZstdCompression   Compression = "zstd"
+)
+
+// 默认压缩阈值， 小于该长度的消息压缩收益很小， 直接原样发送
+const DefaultCompressThreshold = 1024
+
+// 每条消息前的标志位
+const (
+	flagRaw        byte = 0
+	flagCompressed byte = 1
+)
+
+// compressor 对一条完整的消息进行压缩和解压， codec关闭时调用close释放资源
+type compressor interface {
+	compress(src []byte) ([]byte, error)
+	decompress(src []byte) ([]byte, error)
+	close()
+}
+
+// 检查压缩算法是否受支持
+func checkCompression(c Compression) error {
+	switch c {
+	case GzipCompression, SnappyCompression, ZstdCompression:
+		return nil
+	}
+	return fmt.Errorf("codec: unsupported compression %q", c)
+}
+
+func newCompressor(c Compression) (compressor, error) {
+	switch c {
+	case GzipCompression:
+		return gzipCompressor{}, nil
+	case SnappyCompression:
+		return snappyCompressor{}, nil
+	case ZstdCompression:
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		dec, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(MaxFrameSize))
+		if err != nil {
+			_ = enc.Close()
+			return nil, err
+		}
+		return &zstdCompressor{enc: enc, dec: dec}, nil
+	default:
+		return nil, checkCompression(c)
+	}
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) compress(src []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (gzipCompressor) decompress(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+	b, err := ioutil.ReadAll(io.LimitReader(r, MaxFrameSize+1))
+	if err == nil && len(b) > MaxFrameSize {
+		err = ErrFrameTooLarge
+	}
+	return b, err
+}
+
+func (gzipCompressor) close() {}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) compress(src []byte) ([]byte, error) {
+	return snappy.Encode(nil, src), nil
+}
+
+func (snappyCompressor) decompress(src []byte) ([]byte, error) {
+	n, err := snappy.DecodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if n > MaxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+	return snappy.Decode(nil, src)
+}
+
+func (snappyCompressor) close() {}
+
+// zstd的Encoder和Decoder带有后台goroutine， 必须在codec关闭时释放
+type zstdCompressor struct {
+	mu     sync.RWMutex // 压缩和解压可以并发， close需要等待它们完成
+	closed bool
+	enc    *zstd.Encoder
+	dec    *zstd.Decoder
+}
+
+var errCompressorClosed = errors.New("codec: compressor is closed")
+
+func (z *zstdCompressor) compress(src []byte) ([]byte, error) {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	if z.closed {
+		return nil, errCompressorClosed
+	}
+	return z.enc.EncodeAll(src, nil), nil
+}
+
+func (z *zstdCompressor) decompress(src []byte) ([]byte, error) {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	if z.closed {
+		return nil, errCompressorClosed
+	}
+	return z.dec.DecodeAll(src, nil)
+}
+
+func (z *zstdCompressor) close() {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.closed {
+		return
+	}
+	z.closed = true
+	_ = z.enc.Close()
+	z.dec.Close()
+}
+
+// WithCompression 包装任意一种编解码方法， 使其对每条消息按需压缩
+//
+// 内层codec写出的一条完整消息（消息头和消息体）作为一个单元， 在连接上的格式为
+//
+//	| flag(1) | uvarint length | payload |
+//
+// flag表示payload是否经过压缩， 只有长度达到threshold的消息才会被压缩
+func WithCompression(f NewCodecFunc, c Compression, threshold int) (NewCodecFunc, error) {
+	if c == NoCompression {
+		return f, nil
+	}
+	if err := checkCompression(c); err != nil {
+		return nil, err
+	}
+	if threshold <= 0 {
+		threshold = DefaultCompressThreshold
+	}
+	return func(conn io.ReadWriteCloser) Codec {
+		comp, _ := newCompressor(c)
+		cc := &compressCodec{
+			conn:      conn,
+			r:         bufio.NewReader(conn),
+			buf:       bufio.NewWriter(conn),
+			comp:      comp,
+			threshold: threshold,
+		}
+		cc.inner = f(compressConn{cc})
+		return cc
+	}, nil
+}
+
+// 压缩编解码方法类， 对内层codec透明
+type compressCodec struct {
+	inner     Codec
+	conn      io.ReadWriteCloser //conn连接， 通过tcp链接传输编码和解码消息
+	r         *bufio.Reader      //读缓冲区
+	buf       *bufio.Writer      //消息缓冲区， 通过buf.flush（）将缓冲区中消息发出
+	comp      compressor
+	threshold int
+	rmsg      bytes.Reader // 当前正在被内层codec读取的已解压消息
+	wmsg      bytes.Buffer // 内层codec写出的尚未发送的消息
+}
+
+var _ Codec = (*compressCodec)(nil)
+
+// compressConn 是提供给内层codec的连接， 读写都经过compressCodec的消息缓冲
+type compressConn struct {
+	c *compressCodec
+}
+
+func (cc compressConn) Read(p []byte) (int, error) {
+	c := cc.c
+	for c.rmsg.Len() == 0 {
+		if err := c.readMessage(); err != nil {
+			return 0, err
+		}
+	}
+	return c.rmsg.Read(p)
+}
+
+func (cc compressConn) Write(p []byte) (int, error) {
+	return cc.c.wmsg.Write(p)
+}
+
+func (cc compressConn) Close() error {
+	return cc.c.Close()
+}
+
+// 读取一条消息并在需要时解压
+func (c *compressCodec) readMessage() error {
+	flag, err := c.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	n, err := binary.ReadUvarint(c.r)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if n > MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return unexpectedEOF(err)
+	}
+	switch flag {
+	case flagRaw:
+	case flagCompressed:
+		if payload, err = c.comp.decompress(payload); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("codec: invalid compression flag %d", flag)
+	}
+	c.rmsg.Reset(payload)
+	return nil
+}
+
+// 消息头解码
+func (c *compressCodec) ReadHeader(h *Header) error {
+	return c.inner.ReadHeader(h)
+}
+
+// 消息体解码
+func (c *compressCodec) ReadBody(body interface{}) error {
+	return c.inner.ReadBody(body)
+}
+
+// 内层codec将消息写入wmsg后， 整体压缩写入conn
+func (c *compressCodec) Write(h *Header, body interface{}) (err error) {
+	c.wmsg.Reset()
+	if err = c.inner.Write(h, body); err != nil {
+		return
+	}
+	defer func() {
+		_ = c.buf.Flush()
+		if err != nil {
+			_ = c.Close()
+		}
+	}()
+	flag, payload := flagRaw, c.wmsg.Bytes()
+	if len(payload) >= c.threshold {
+		if payload, err = c.comp.compress(payload); err != nil {
+			log.Println("rpc: compress error:", err)
+			return
+		}
+		flag = flagCompressed
+	}
+	var prefix [1 + binary.MaxVarintLen64]byte
+	prefix[0] = flag
+	n := binary.PutUvarint(prefix[1:], uint64(len(payload)))
+	if _, err = c.buf.Write(prefix[:1+n]); err != nil {
+		return
+	}
+	_, err = c.buf.Write(payload)
+	return
+}
+
+// 关闭conn连接 conn.close（）， 同时释放压缩算法的资源
+func (c *compressCodec) Close() error {
+	c.comp.close()
+	return c.conn.Close()
+}
@@ -0,0 +1,68 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+)
+
+// json类型编解码方法类
+// 消息头和消息体各自编码为一行json，以换行符分隔，便于非go客户端以及nc等工具调试
+type JsonCodec struct {
+	conn io.ReadWriteCloser //conn连接， 通过tcp链接传输编码和解码消息
+	buf  *bufio.Writer      //消息缓冲区， 通过buf.flush（）将缓冲区中消息发出
+	dec  *json.Decoder      //json消息解码类型
+	enc  *json.Encoder      //json消息编码类型
+}
+
+var _ Codec = (*JsonCodec)(nil)
+
+// json编解码类初始化函数
+func NewJsonCodec(conn io.ReadWriteCloser) Codec {
+	buf := bufio.NewWriter(conn)
+	return &JsonCodec{
+		conn: conn,
+		buf:  buf,
+		dec:  json.NewDecoder(conn),
+		enc:  json.NewEncoder(buf),
+	}
+}
+
+// 消息头解码
+func (c *JsonCodec) ReadHeader(h *Header) error {
+	return c.dec.Decode(h)
+}
+
+// 消息体解码 body为nil时读出并丢弃这一条消息体， 保证流上下一条消息可以正确解码
+func (c *JsonCodec) ReadBody(body interface{}) error {
+	if body == nil {
+		var discard json.RawMessage
+		return c.dec.Decode(&discard)
+	}
+	return c.dec.Decode(body)
+}
+
+// 写消息到conn中 Encode会在每个值后追加换行符
+func (c *JsonCodec) Write(h *Header, body interface{}) (err error) {
+	defer func() {
+		_ = c.buf.Flush()
+		if err != nil {
+			_ = c.Close()
+		}
+	}()
+	if err = c.enc.Encode(h); err != nil {
+		log.Println("rpc: json error encoding header:", err)
+		return
+	}
+	if err = c.enc.Encode(body); err != nil {
+		log.Println("rpc: json error encoding body:", err)
+		return
+	}
+	return
+}
+
+// 关闭conn连接 conn.close（）
+func (c *JsonCodec) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,68 @@
+package codec
+
+import (
+	"bufio"
+	"io"
+	"log"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// msgpack类型编解码方法类
+// 与GobCodec一样在连接上连续编码消息头和消息体， 但格式紧凑且跨语言
+type MsgpackCodec struct {
+	conn io.ReadWriteCloser //conn连接， 通过tcp链接传输编码和解码消息
+	buf  *bufio.Writer      //消息缓冲区， 通过buf.flush（）将缓冲区中消息发出
+	dec  *msgpack.Decoder   //msgpack消息解码类型
+	enc  *msgpack.Encoder   //msgpack消息编码类型
+}
+
+var _ Codec = (*MsgpackCodec)(nil)
+
+// msgpack编解码类初始化函数
+func NewMsgpackCodec(conn io.ReadWriteCloser) Codec {
+	buf := bufio.NewWriter(conn)
+	return &MsgpackCodec{
+		conn: conn,
+		buf:  buf,
+		dec:  msgpack.NewDecoder(conn),
+		enc:  msgpack.NewEncoder(buf),
+	}
+}
+
+// 消息头解码
+func (c *MsgpackCodec) ReadHeader(h *Header) error {
+	return c.dec.Decode(h)
+}
+
+// 消息体解码 body为nil时跳过这一条消息体
+func (c *MsgpackCodec) ReadBody(body interface{}) error {
+	if body == nil {
+		return c.dec.Skip()
+	}
+	return c.dec.Decode(body)
+}
+
+// 写消息到conn中
+func (c *MsgpackCodec) Write(h *Header, body interface{}) (err error) {
+	defer func() {
+		_ = c.buf.Flush()
+		if err != nil {
+			_ = c.Close()
+		}
+	}()
+	if err = c.enc.Encode(h); err != nil {
+		log.Println("rpc: msgpack error encoding header:", err)
+		return
+	}
+	if err = c.enc.Encode(body); err != nil {
+		log.Println("rpc: msgpack error encoding body:", err)
+		return
+	}
+	return
+}
+
+// 关闭conn连接 conn.close（）
+func (c *MsgpackCodec) Close() error {
+	return c.conn.Close()
+}
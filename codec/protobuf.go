@@ -0,0 +1,268 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// protobuf类型编解码方法类
+// 消息头和消息体都编码为protobuf消息， 每条消息前带有uvarint长度前缀（与protobuf的delimited格式一致），
+// 消息头对应的schema为：
+//
+//	message Header {
+//	  string service_method = 1;
+//	  uint64 seq = 2;
+//	  string error = 3;
+//	  map<string, string> metadata = 4;
+//	  uint32 type = 5;
+//	  int64 timeout = 6;
+//	  uint32 error_code = 7;
+//	  map<string, string> error_details = 8;
+//	}
+type ProtobufCodec struct {
+	conn io.ReadWriteCloser //conn连接， 通过tcp链接传输编码和解码消息
+	r    *bufio.Reader      //读缓冲区
+	buf  *bufio.Writer      //消息缓冲区， 通过buf.flush（）将缓冲区中消息发出
+}
+
+var _ Codec = (*ProtobufCodec)(nil)
+
+// 消息头字段号
+const (
+	pbServiceMethod protowire.Number = 1
+	pbSeq           protowire.Number = 2
+	pbError         protowire.Number = 3
+	pbMetadata      protowire.Number = 4
+	pbType          protowire.Number = 5
+	pbTimeout       protowire.Number = 6
+	pbErrorCode     protowire.Number = 7
+	pbErrorDetails  protowire.Number = 8
+)
+
+// protobuf编解码类初始化函数
+func NewProtobufCodec(conn io.ReadWriteCloser) Codec {
+	return &ProtobufCodec{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		buf:  bufio.NewWriter(conn),
+	}
+}
+
+// 读取一条带长度前缀的消息
+func (c *ProtobufCodec) readMessage() ([]byte, error) {
+	n, err := binary.ReadUvarint(c.r)
+	if err != nil {
+		return nil, err
+	}
+	if n > MaxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(c.r, b); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return b, nil
+}
+
+// 消息头解码
+func (c *ProtobufCodec) ReadHeader(h *Header) error {
+	b, err := c.readMessage()
+	if err != nil {
+		return err
+	}
+	return unmarshalProtoHeader(b, h)
+}
+
+// 消息体解码 body为nil时丢弃这一条消息体
+func (c *ProtobufCodec) ReadBody(body interface{}) error {
+	b, err := c.readMessage()
+	if err != nil || body == nil {
+		return err
+	}
+	m, ok := body.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%w: protobuf can't decode into %T, it does not implement proto.Message", ErrBodyType, body)
+	}
+	return proto.Unmarshal(b, m)
+}
+
+// 写消息到conn中
+// body不是proto.Message时直接返回ErrBodyType， 不会向连接写入任何数据
+func (c *ProtobufCodec) Write(h *Header, body interface{}) (err error) {
+	var b []byte
+	switch m := body.(type) {
+	case proto.Message:
+		if b, err = proto.Marshal(m); err != nil {
+			return
+		}
+	default:
+		// 错误响应的消息体是空结构体， 编码为空消息
+		if body != nil && !isEmptyStruct(body) {
+			return fmt.Errorf("%w: protobuf can't encode %T, it does not implement proto.Message", ErrBodyType, body)
+		}
+	}
+	defer func() {
+		_ = c.buf.Flush()
+		if err != nil {
+			_ = c.Close()
+		}
+	}()
+	hb := marshalProtoHeader(h)
+	if _, err = c.buf.Write(protowire.AppendVarint(nil, uint64(len(hb)))); err == nil {
+		_, err = c.buf.Write(hb)
+	}
+	if err != nil {
+		log.Println("rpc: protobuf error encoding header:", err)
+		return
+	}
+	if _, err = c.buf.Write(protowire.AppendVarint(nil, uint64(len(b)))); err == nil {
+		_, err = c.buf.Write(b)
+	}
+	if err != nil {
+		log.Println("rpc: protobuf error encoding body:", err)
+		return
+	}
+	return
+}
+
+// 关闭conn连接 conn.close（）
+func (c *ProtobufCodec) Close() error {
+	return c.conn.Close()
+}
+
+func isEmptyStruct(v interface{}) bool {
+	t := reflect.TypeOf(v)
+	return t.Kind() == reflect.Struct && t.NumField() == 0
+}
+
+func marshalProtoHeader(h *Header) []byte {
+	var b []byte
+	if h.ServiceMethod != "" {
+		b = protowire.AppendTag(b, pbServiceMethod, protowire.BytesType)
+		b = protowire.AppendString(b, h.ServiceMethod)
+	}
+	if h.Seq != 0 {
+		b = protowire.AppendTag(b, pbSeq, protowire.VarintType)
+		b = protowire.AppendVarint(b, h.Seq)
+	}
+	if h.Error != "" {
+		b = protowire.AppendTag(b, pbError, protowire.BytesType)
+		b = protowire.AppendString(b, h.Error)
+	}
+	if h.Type != MsgCall {
+		b = protowire.AppendTag(b, pbType, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(h.Type))
+	}
+	if h.Timeout != 0 {
+		b = protowire.AppendTag(b, pbTimeout, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(h.Timeout))
+	}
+	if h.ErrorCode != 0 {
+		b = protowire.AppendTag(b, pbErrorCode, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(h.ErrorCode))
+	}
+	b = appendProtoMap(b, pbMetadata, h.Metadata)
+	return appendProtoMap(b, pbErrorDetails, h.ErrorDetails)
+}
+
+func appendProtoMap(b []byte, num protowire.Number, m map[string]string) []byte {
+	for k, v := range m {
+		// map字段的每个键值对编码为一个内嵌消息， key和value的字段号分别为1和2
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, k)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendString(entry, v)
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b
+}
+
+var errMalformedProtoHeader = errors.New("codec: malformed protobuf header")
+
+func unmarshalProtoHeader(b []byte, h *Header) error {
+	*h = Header{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return errMalformedProtoHeader
+		}
+		b = b[n:]
+		switch {
+		case num == pbServiceMethod && typ == protowire.BytesType:
+			h.ServiceMethod, n = protowire.ConsumeString(b)
+		case num == pbSeq && typ == protowire.VarintType:
+			h.Seq, n = protowire.ConsumeVarint(b)
+		case num == pbError && typ == protowire.BytesType:
+			h.Error, n = protowire.ConsumeString(b)
+		case num == pbType && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			h.Type = MessageType(v)
+		case num == pbTimeout && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			h.Timeout = int64(v)
+		case num == pbErrorCode && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			h.ErrorCode = uint32(v)
+		case (num == pbMetadata || num == pbErrorDetails) && typ == protowire.BytesType:
+			m := &h.Metadata
+			if num == pbErrorDetails {
+				m = &h.ErrorDetails
+			}
+			var entry []byte
+			if entry, n = protowire.ConsumeBytes(b); n >= 0 {
+				if *m == nil {
+					*m = make(map[string]string)
+				}
+				if err := unmarshalProtoMapEntry(entry, *m); err != nil {
+					return err
+				}
+			}
+		default:
+			// 跳过未知字段
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return errMalformedProtoHeader
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func unmarshalProtoMapEntry(b []byte, m map[string]string) error {
+	var key, value string
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return errMalformedProtoHeader
+		}
+		b = b[n:]
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			key, n = protowire.ConsumeString(b)
+		case num == 2 && typ == protowire.BytesType:
+			value, n = protowire.ConsumeString(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return errMalformedProtoHeader
+		}
+		b = b[n:]
+	}
+	m[key] = value
+	return nil
+}
@@ -5,8 +5,10 @@
 package geerpc
 
 import (
+	"encoding/json"
 	"fmt"
 	"html/template"
+	"log"
 	"net/http"
 )
 
@@ -18,11 +20,15 @@ const debugText = `<html>
 	Service {{.Name}}
 	<hr>
 		<table>
-		<th align=center>Method</th><th align=center>Calls</th>
+		<th align=center>Method</th><th align=center>Calls</th><th align=center>Errors</th><th align=center>Panics</th><th align=center>In flight</th><th align=center>Avg latency</th>
 		{{range $name, $mtype := .Method}}
 			<tr>
 			<td align=left font=fixed>{{$name}}({{$mtype.ArgType}}, {{$mtype.ReplyType}}) error</td>
 			<td align=center>{{$mtype.NumCalls}}</td>
+			<td align=center>{{$mtype.NumErrors}}</td>
+			<td align=center>{{$mtype.NumPanics}}</td>
+			<td align=center>{{$mtype.InFlight}}</td>
+			<td align=center>{{$mtype.AvgLatency}}</td>
 			</tr>
 		{{end}}
 		</table>
@@ -42,7 +48,15 @@ type debugService struct {
 }
 
 // Runs at /debug/geerpc
+// With ?format=json, the result of Server.Stats is written as JSON.
 func (server debugHTTP) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(server.Stats()); err != nil {
+			log.Println("rpc: error encoding debug stats:", err)
+		}
+		return
+	}
 	// Build a sorted version of the data.
 	var services []debugService
 	server.serviceMap.Range(func(namei, svci interface{}) bool {
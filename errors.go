@@ -0,0 +1,137 @@
+package geerpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geerpc/codec"
+	"strconv"
+)
+
+// Code 是RPC错误的类型， 随错误信息一起通过codec.Header.ErrorCode传输，
+// 调用方据此区分错误， 不需要匹配错误信息
+type Code uint32
+
+const (
+	CodeOK                Code = iota // 没有错误
+	CodeUnknown                       // 服务方法返回的普通error， 或者对端没有发送错误码
+	CodeInvalidArgument               // 请求不合法， 如ServiceMethod格式错误、流式与非流式调用不匹配
+	CodeNotFound                      // 找不到服务或方法
+	CodeDeadlineExceeded              // 请求没有在截止时间内处理完成
+	CodeCanceled                      // 请求被取消
+	CodeUnauthenticated               // 客户端没有通过认证
+	CodePermissionDenied              // 调用方没有调用这个方法的权限
+	CodeResourceExhausted             // 服务器正在处理的请求已达上限
+	CodeUnavailable                   // 连接已经关闭
+	CodeCodec                         // 参数或返回值编解码失败
+	CodeInternal                      // 服务方法panic等服务端内部错误
+)
+
+var codeNames = [...]string{
+	CodeOK:                "ok",
+	CodeUnknown:           "unknown",
+	CodeInvalidArgument:   "invalid_argument",
+	CodeNotFound:          "not_found",
+	CodeDeadlineExceeded:  "deadline_exceeded",
+	CodeCanceled:          "canceled",
+	CodeUnauthenticated:   "unauthenticated",
+	CodePermissionDenied:  "permission_denied",
+	CodeResourceExhausted: "resource_exhausted",
+	CodeUnavailable:       "unavailable",
+	CodeCodec:             "codec",
+	CodeInternal:          "internal",
+}
+
+func (c Code) String() string {
+	if int(c) < len(codeNames) {
+		return codeNames[c]
+	}
+	return "code(" + strconv.FormatUint(uint64(c), 10) + ")"
+}
+
+// RPCError 是带有错误码的错误， 服务方法返回的RPCError（包括被包装的）会把错误码和Details
+// 一起发送给客户端。 客户端收到的所有服务端错误都是*RPCError， 客户端自身的参数错误、连接超时等
+// 也带有错误码； 网络、TLS和编解码错误按原样返回， ErrorCode返回CodeUnknown：
+//
+//	var rpcErr *geerpc.RPCError
+//	if errors.As(err, &rpcErr) && rpcErr.Code == geerpc.CodeNotFound {
+//		...
+//	}
+type RPCError struct {
+	Code    Code
+	Message string
+	Details map[string]string // 可选的附加信息
+}
+
+// NewError 返回错误码为code的RPCError
+func NewError(code Code, message string) *RPCError {
+	return &RPCError{Code: code, Message: message}
+}
+
+// Errorf 按照format生成错误信息， 返回错误码为code的RPCError
+func Errorf(code Code, format string, a ...interface{}) *RPCError {
+	return &RPCError{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+// ErrorCode 返回err的错误码， err为nil时返回CodeOK， 不是RPCError时返回CodeUnknown
+func ErrorCode(err error) Code {
+	if err == nil {
+		return CodeOK
+	}
+	var e *RPCError
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeUnknown
+}
+
+// setError 将err写入响应头， 错误码和Details来自err链上的RPCError
+func setError(h *codec.Header, err error) {
+	h.Error = err.Error()
+	h.ErrorCode = uint32(ErrorCode(err))
+	h.ErrorDetails = nil
+	var e *RPCError
+	if errors.As(err, &e) {
+		h.ErrorDetails = e.Details
+	}
+}
+
+// 服务端返回的这些错误在客户端被还原为同一个变量， 调用方可以直接比较；
+// 错误码和错误信息都相同时才会还原， 服务方法返回的同名普通错误不受影响
+var wellKnownErrors = make(map[wellKnownKey]error)
+
+type wellKnownKey struct {
+	code    Code
+	message string
+}
+
+func init() {
+	for _, err := range []error{ErrDeadlineExceeded, ErrServerBusy, ErrUnauthenticated, ErrPermissionDenied} {
+		wellKnownErrors[wellKnownKey{ErrorCode(err), err.Error()}] = err
+	}
+}
+
+// serverError 将响应头中的错误信息转换为*RPCError
+func serverError(h *codec.Header) error {
+	if err, ok := wellKnownErrors[wellKnownKey{Code(h.ErrorCode), h.Error}]; ok {
+		return err
+	}
+	code := Code(h.ErrorCode)
+	if code == CodeOK {
+		code = CodeUnknown
+	}
+	return &RPCError{Code: code, Message: h.Error, Details: h.ErrorDetails}
+}
+
+// callError 将客户端ctx结束的原因转换为Call返回的错误
+func callError(err error) error {
+	code := CodeCanceled
+	if err == context.DeadlineExceeded {
+		code = CodeDeadlineExceeded
+	}
+	return NewError(code, "rpc client: call failed: "+err.Error())
+}
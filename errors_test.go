@@ -0,0 +1,138 @@
+package geerpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geerpc/codec"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type Store int
+
+func (s Store) Get(args *wrapperspb.StringValue, reply *wrapperspb.StringValue) error {
+	switch args.Value {
+	case "plain":
+		return errors.New("plain error")
+	case "panic":
+		panic("boom")
+	case "ok":
+		reply.Value = "value"
+		return nil
+	}
+	err := &RPCError{Code: CodeNotFound, Message: "no such key", Details: map[string]string{"key": args.Value}}
+	return fmt.Errorf("store: %w", err)
+}
+
+// Len的返回值不是proto.Message， 不能用protobuf编码
+func (s Store) Len(args *wrapperspb.StringValue, reply *int) error {
+	*reply = len(args.Value)
+	return nil
+}
+
+func TestRPCError(t *testing.T) {
+	t.Parallel()
+	server := NewServer()
+	var s Store
+	_ = server.Register(&s)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+
+	for _, ct := range []codec.Type{codec.GobType, codec.JsonType, codec.BinaryType, codec.MsgpackType, codec.ProtobufType} {
+		client, err := Dial("tcp", l.Addr().String(), &Option{CodecType: ct})
+		_assert(err == nil, "failed to dial with %s: %v", ct, err)
+		get := func(serviceMethod, key string) *RPCError {
+			err := client.Call(context.Background(), serviceMethod, wrapperspb.String(key), &wrapperspb.StringValue{})
+			var rpcErr *RPCError
+			_assert(errors.As(err, &rpcErr), "%s: expect *RPCError, got %T %v", ct, err, err)
+			return rpcErr
+		}
+
+		e := get("Store.Get", "missing")
+		_assert(e.Code == CodeNotFound && e.Message == "store: no such key" && e.Details["key"] == "missing",
+			"%s: expect the application error to keep its code and details, got %+v", ct, e)
+		e = get("Store.Get", "plain")
+		_assert(e.Code == CodeUnknown && e.Message == "plain error", "%s: expect CodeUnknown, got %+v", ct, e)
+		e = get("Store.Get", "panic")
+		_assert(e.Code == CodeInternal, "%s: expect CodeInternal, got %+v", ct, e)
+		e = get("Store.Unknown", "ok")
+		_assert(e.Code == CodeNotFound && e.Details == nil, "%s: expect CodeNotFound, got %+v", ct, e)
+		e = get("Unknown.Get", "ok")
+		_assert(e.Code == CodeNotFound, "%s: expect CodeNotFound, got %+v", ct, e)
+
+		// the error fields of the last response must not leak into the next one
+		reply := &wrapperspb.StringValue{}
+		err = client.Call(context.Background(), "Store.Get", wrapperspb.String("ok"), reply)
+		_assert(err == nil && reply.Value == "value", "%s: expect the call to succeed: %v", ct, err)
+		_ = client.Close()
+	}
+}
+
+func TestRPCError_WellKnown(t *testing.T) {
+	_assert(ErrorCode(nil) == CodeOK, "expect CodeOK for nil")
+	_assert(ErrorCode(errors.New("x")) == CodeUnknown, "expect CodeUnknown for a plain error")
+	_assert(ErrorCode(fmt.Errorf("wrapped: %w", ErrServerBusy)) == CodeResourceExhausted, "expect the code of a wrapped error")
+	_assert(CodeDeadlineExceeded.String() == "deadline_exceeded", "unexpected name %s", CodeDeadlineExceeded)
+	_assert(Code(100).String() == "code(100)", "unexpected name %s", Code(100))
+
+	// well-known errors are restored to the same variables on the client
+	for _, want := range []error{ErrDeadlineExceeded, ErrServerBusy, ErrUnauthenticated, ErrPermissionDenied} {
+		var h codec.Header
+		setError(&h, want)
+		_assert(serverError(&h) == want, "expect %v to be restored", want)
+	}
+	// errors from peers without error codes are CodeUnknown
+	err := serverError(&codec.Header{Error: "old server"})
+	_assert(ErrorCode(err) == CodeUnknown && err.Error() == "old server", "unexpected error %+v", err)
+	// an application error with the same message is not mistaken for a well-known one
+	var h codec.Header
+	setError(&h, errors.New(ErrServerBusy.Error()))
+	err = serverError(&h)
+	_assert(err != ErrServerBusy && ErrorCode(err) == CodeUnknown, "expect a plain error, got %+v", err)
+
+	// client side failures carry codes as well
+	_, err = XDial("localhost:0")
+	_assert(ErrorCode(err) == CodeInvalidArgument, "expect CodeInvalidArgument, got %v", err)
+	_, err = Dial("tcp", "localhost:0", &Option{}, &Option{})
+	_assert(ErrorCode(err) == CodeInvalidArgument, "expect CodeInvalidArgument, got %v", err)
+	_assert(ErrorCode(assignTo(new(string), reflect.ValueOf(1))) == CodeInvalidArgument, "expect CodeInvalidArgument")
+	_assert(ErrorCode(errStreamOverflow) == CodeInvalidArgument && ErrorCode(errStreamClosed) == CodeInvalidArgument,
+		"expect stream errors to be CodeInvalidArgument")
+
+	server := NewServer()
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = client.Call(ctx, "Health.Check", "", new(ServingStatus))
+	_assert(ErrorCode(err) == CodeCanceled, "expect CodeCanceled, got %v", err)
+}
+
+func TestRPCError_ReplyEncoding(t *testing.T) {
+	t.Parallel()
+	server := NewServer()
+	var s Store
+	_ = server.Register(&s)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	client, err := Dial("tcp", l.Addr().String(), &Option{CodecType: codec.ProtobufType})
+	_assert(err == nil, "failed to dial: %v", err)
+	defer func() { _ = client.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var n int
+	err = client.Call(ctx, "Store.Len", wrapperspb.String("abc"), &n)
+	_assert(ErrorCode(err) == CodeCodec, "expect a reply that can't be encoded to fail with CodeCodec, got %v", err)
+	// the connection is still usable
+	reply := &wrapperspb.StringValue{}
+	err = client.Call(ctx, "Store.Get", wrapperspb.String("ok"), reply)
+	_assert(err == nil && reply.Value == "value", "expect the call to succeed: %v", err)
+}
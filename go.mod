@@ -1,3 +1,9 @@
 module geerpc
 
 go 1.13
+
+require (
+	github.com/klauspost/compress v1.11.13
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	google.golang.org/protobuf v1.27.1
+)
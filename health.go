@@ -0,0 +1,186 @@
+package geerpc
+
+import (
+	"context"
+	"sync"
+)
+
+// ServingStatus 是服务的健康状态
+type ServingStatus int
+
+const (
+	StatusUnknown    ServingStatus = iota // 服务不存在
+	StatusServing                         // 服务可以正常处理请求
+	StatusNotServing                      // 服务暂时不能处理请求， 或服务器正在关闭
+)
+
+func (s ServingStatus) String() string {
+	switch s {
+	case StatusServing:
+		return "SERVING"
+	case StatusNotServing:
+		return "NOT_SERVING"
+	}
+	return "UNKNOWN"
+}
+
+// HealthService 是健康检查服务的名称， NewServer创建的服务器自动注册了这个服务
+const HealthService = "Health"
+
+// Health 是内置的健康检查服务， 提供两个方法：
+//
+//	Health.Check 返回服务当前的状态
+//	Health.Watch 流式方法， 先发送服务当前的状态， 之后每次状态变化时再发送新的状态
+//
+// 服务名为空表示整个服务器。 没有通过Server.SetServingStatus设置过状态的服务，
+// 注册了即为StatusServing； 服务器关闭后所有服务都是StatusNotServing
+type Health struct {
+	server  *Server
+	mu      sync.Mutex // protect following
+	status  map[string]ServingStatus
+	changed chan struct{} // 状态变化时关闭并替换为新的channel
+	down    bool          // 服务器正在关闭
+}
+
+func newHealth(server *Server) *Health {
+	return &Health{
+		server:  server,
+		status:  make(map[string]ServingStatus),
+		changed: make(chan struct{}),
+	}
+}
+
+// RegisterHealth 在服务器上注册健康检查服务Health， 已经有同名的服务时返回错误；
+// NewServer已经注册了Health， 零值的Server或者调用DisableHealth之后可以用它重新注册
+func (server *Server) RegisterHealth() error {
+	return server.Register(server.getHealth(true))
+}
+
+// DisableHealth 注销自动注册的Health服务， 应用需要自己使用Health这个服务名时调用；
+// 通过SetServingStatus设置的状态仍然保留
+func (server *Server) DisableHealth() {
+	h := server.getHealth(false)
+	if h == nil {
+		return
+	}
+	if svci, ok := server.serviceMap.Load(HealthService); ok && svci.(*service).rcvr.Interface() == h {
+		server.serviceMap.Delete(HealthService)
+	}
+}
+
+// 返回服务器的健康状态， 没有时create为true则创建。
+// 没有注册Health服务时也可以通过SetServingStatus设置状态， 注册之后生效
+func (server *Server) getHealth(create bool) *Health {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.health == nil && create {
+		server.health = newHealth(server)
+		server.health.down = server.inShutdown
+	}
+	return server.health
+}
+
+// 返回服务当前的状态， 状态变化时会被关闭的channel， 以及服务器是否正在关闭
+func (h *Health) get(service string) (ServingStatus, <-chan struct{}, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.down {
+		return StatusNotServing, h.changed, true
+	}
+	if status, ok := h.status[service]; ok {
+		return status, h.changed, false
+	}
+	if service == "" {
+		return StatusServing, h.changed, false
+	}
+	if _, ok := h.server.serviceMap.Load(service); ok {
+		return StatusServing, h.changed, false
+	}
+	return StatusUnknown, h.changed, false
+}
+
+// 唤醒所有的Watch
+func (h *Health) notifyLocked() {
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+func (h *Health) set(service string, status ServingStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status[service] = status
+	h.notifyLocked()
+}
+
+// 服务注册后状态可能从StatusUnknown变为StatusServing
+func (h *Health) registered() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.notifyLocked()
+}
+
+func (h *Health) shutdown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.down {
+		h.down = true
+		h.notifyLocked()
+	}
+}
+
+// Check 返回服务当前的状态， 服务不存在时返回error
+func (h *Health) Check(service string, reply *ServingStatus) error {
+	status, _, _ := h.get(service)
+	if status == StatusUnknown {
+		return NewError(CodeNotFound, "rpc server: health: unknown service "+service)
+	}
+	*reply = status
+	return nil
+}
+
+// Watch 发送服务当前的状态， 之后每次状态变化时发送新的状态， 直到客户端取消；
+// 服务器关闭时发送StatusNotServing后结束
+func (h *Health) Watch(service string, stream *ServerStream) error {
+	last := ServingStatus(-1)
+	for {
+		status, changed, down := h.get(service)
+		if status != last {
+			if err := stream.Send(status); err != nil {
+				return err
+			}
+			last = status
+		}
+		if down {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// SetServingStatus 设置服务的健康状态， service为空表示整个服务器，
+// 也可以为没有注册的名称设置状态， 表示应用自定义的依赖
+func (server *Server) SetServingStatus(service string, status ServingStatus) {
+	server.getHealth(true).set(service, status)
+}
+
+// HealthCheck 调用服务端的Health.Check， service为空时检查整个服务器
+func (client *Client) HealthCheck(ctx context.Context, service string) (ServingStatus, error) {
+	var status ServingStatus
+	err := client.Call(ctx, HealthService+".Check", service, &status)
+	return status, err
+}
+
+// WatchHealth 调用服务端的Health.Watch， 每次Next返回true时status为服务最新的状态
+//
+//	var status geerpc.ServingStatus
+//	stream, err := client.WatchHealth(ctx, "Foo", &status)
+//	for stream.Next() {
+//		// 使用status
+//	}
+func (client *Client) WatchHealth(ctx context.Context, service string, status *ServingStatus) (*ClientStream, error) {
+	return client.Stream(ctx, HealthService+".Watch", service, status)
+}
@@ -0,0 +1,72 @@
+package geerpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServer_Health(t *testing.T) {
+	t.Parallel()
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+	ctx := context.Background()
+
+	status, err := client.HealthCheck(ctx, "")
+	_assert(err == nil && status == StatusServing, "expect the server to be serving, got %s, %v", status, err)
+	status, err = client.HealthCheck(ctx, "Foo")
+	_assert(err == nil && status == StatusServing, "expect Foo to be serving, got %s, %v", status, err)
+	_, err = client.HealthCheck(ctx, "Unknown")
+	_assert(err != nil, "expect an unknown service error")
+
+	var watched ServingStatus
+	stream, err := client.WatchHealth(ctx, "Foo", &watched)
+	_assert(err == nil, "failed to watch: %v", err)
+	_assert(stream.Next() && watched == StatusServing, "expect the current status first, got %s", watched)
+
+	server.SetServingStatus("Foo", StatusNotServing)
+	status, _ = client.HealthCheck(ctx, "Foo")
+	_assert(status == StatusNotServing, "expect Foo not to be serving, got %s", status)
+	_assert(stream.Next() && watched == StatusNotServing, "expect the status change, got %s", watched)
+	server.SetServingStatus("Foo", StatusServing)
+	_assert(stream.Next() && watched == StatusServing, "expect the status change, got %s", watched)
+
+	// Watch ends with NOT_SERVING when the server shuts down
+	done := make(chan error, 1)
+	go func() {
+		shutdownCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		done <- server.Shutdown(shutdownCtx)
+	}()
+	_assert(stream.Next() && watched == StatusNotServing, "expect NOT_SERVING on shutdown, got %s", watched)
+	_assert(!stream.Next() && stream.Err() == nil, "expect the watch to end, got %v", stream.Err())
+	_assert(<-done == nil, "expect the shutdown to complete")
+}
+
+func TestServer_DisableHealth(t *testing.T) {
+	// every server created by NewServer has the health service
+	server := NewServer()
+	_, _, err := server.findService(HealthService + ".Check")
+	_assert(err == nil, "expect the health service by default: %v", err)
+	_assert(server.RegisterHealth() != nil, "expect a duplicate service error")
+	// applications that need the name can opt out
+	server.DisableHealth()
+	_, _, err = server.findService(HealthService + ".Check")
+	_assert(err != nil, "expect the health service to be removed")
+	_assert(server.RegisterHealth() == nil, "failed to register health again")
+
+	// a zero value server has no health service
+	var zero Server
+	zero.SetServingStatus("Foo", StatusNotServing)
+	_assert(zero.Shutdown(context.Background()) == nil, "expect shutdown to complete")
+	_assert(zero.Close() == nil, "expect close to complete")
+	_assert(zero.RegisterHealth() == nil, "expect health to register after shutdown")
+	status, _, down := zero.getHealth(false).get("Foo")
+	_assert(status == StatusNotServing && down, "expect NOT_SERVING after shutdown, got %s", status)
+}
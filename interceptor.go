@@ -0,0 +1,87 @@
+package geerpc
+
+import (
+	"context"
+)
+
+// ServerInfo 描述拦截器所拦截的一次调用
+type ServerInfo struct {
+	ServiceMethod string // 格式“Service.Method”
+	Service       string
+	Method        string
+}
+
+// Handler 处理一次调用， argv和replyv分别为解码后的参数和待填充的返回值
+type Handler func(ctx context.Context, argv, replyv interface{}) error
+
+// ServerInterceptor 包裹服务方法的调用， 可以在调用前后执行日志、鉴权、统计等逻辑，
+// 调用next继续执行后续的拦截器和服务方法， 不调用next而直接返回error即可中断这次调用。
+// 请求元数据可以通过FromIncomingContext(ctx)获得
+type ServerInterceptor func(ctx context.Context, info *ServerInfo, argv, replyv interface{}, next Handler) error
+
+// Use 按顺序添加服务端拦截器， 先添加的拦截器在外层
+func (server *Server) Use(interceptors ...ServerInterceptor) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.interceptors = append(server.interceptors, interceptors...)
+}
+
+// 将拦截器和handler组合成一个Handler
+func chainInterceptors(interceptors []ServerInterceptor, info *ServerInfo, handler Handler) Handler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, argv, replyv interface{}) error {
+			return interceptor(ctx, info, argv, replyv, next)
+		}
+	}
+	return handler
+}
+
+// 经过拦截器链调用请求对应的服务方法
+func (server *Server) invoke(ctx context.Context, req *request) error {
+	server.mu.Lock()
+	interceptors := server.interceptors
+	server.mu.Unlock()
+	if len(interceptors) == 0 {
+		return req.svc.call(ctx, req.mtype, req.argv, req.replyv)
+	}
+	info := &ServerInfo{
+		ServiceMethod: req.h.ServiceMethod,
+		Service:       req.svc.name,
+		Method:        req.mtype.method.Name,
+	}
+	handler := chainInterceptors(interceptors, info, func(ctx context.Context, argv, replyv interface{}) error {
+		// 拦截器可能替换了参数， 以传入的值为准， 类型不对时返回错误；
+		// 发送的是原来的replyv， 替换了返回值会使结果丢失， 因此同样返回错误
+		av, rv, err := req.svc.checkArgs(req.mtype, argv, replyv)
+		if err != nil {
+			return err
+		}
+		if rv.Pointer() != req.replyv.Pointer() {
+			return NewError(CodeInternal, "rpc server: interceptor replaced the reply of "+req.h.ServiceMethod)
+		}
+		return req.svc.callMethod(ctx, req.mtype, av, rv)
+	})
+	// 拦截器的panic和服务方法一样被恢复
+	return req.svc.guard(req.mtype, func() error {
+		return handler(ctx, req.argv.Interface(), req.replyv.Interface())
+	})
+}
+
+// Invoker 发送一次调用并等待结果
+type Invoker func(ctx context.Context, serviceMethod string, args, reply interface{}) error
+
+// ClientInterceptor 包裹客户端的每一次调用， 可以通过NewOutgoingContext修改发送的元数据，
+// 也可以记录日志、统计， 或者多次调用invoker实现重试
+type ClientInterceptor func(ctx context.Context, serviceMethod string, args, reply interface{}, invoker Invoker) error
+
+// 将客户端拦截器和invoker组合成一个Invoker， 先配置的拦截器在外层
+func chainClientInterceptors(interceptors []ClientInterceptor, invoker Invoker) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+			return interceptor(ctx, serviceMethod, args, reply, next)
+		}
+	}
+	return invoker
+}
@@ -0,0 +1,177 @@
+package geerpc
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BusyPolicy 决定请求数达到上限时如何处理新的请求
+type BusyPolicy int
+
+const (
+	RejectWhenBusy BusyPolicy = iota // 直接返回ErrServerBusy
+	QueueWhenBusy                    // 在有界队列中等待， 队列满时返回ErrServerBusy
+)
+
+// Limits 限制服务器同时处理的请求数， 0表示不限制
+type Limits struct {
+	MaxInFlight     int        // 整个服务器同时处理的请求数上限
+	MaxConnInFlight int        // 每个连接同时处理的请求数上限
+	Policy          BusyPolicy // 达到上限时的处理策略
+	QueueSize       int        // Policy为QueueWhenBusy时排队等待的请求数上限
+}
+
+// ErrServerBusy 表示服务器正在处理的请求已达上限， 客户端可以换一个服务器重试
+var ErrServerBusy error = NewError(CodeResourceExhausted, "rpc server: server busy")
+
+// limiter 统计正在处理的请求数， 没有名额的请求按到达顺序放入有界队列，
+// 排队的请求不占用goroutine， 名额释放时由release启动可以执行的请求
+type limiter struct {
+	Limits
+	mu       sync.Mutex // protect following
+	inFlight int        // 整个服务器正在处理的请求数
+	queue    []*waiter  // 等待名额的请求
+}
+
+// connSem 是连接级别的名额， 由limiter.mu保护
+type connSem struct {
+	inFlight int
+}
+
+// waiter 是一个排队的请求， 获得名额或者被移出队列时调用一次start，
+// 获得名额时err为nil
+type waiter struct {
+	conn  *connSem
+	start func(err error)
+	timer *time.Timer // 请求的截止时间， 到期时移出队列
+}
+
+func newLimiter(l Limits) *limiter {
+	return &limiter{Limits: l}
+}
+
+// 为一个新连接创建连接级别的名额
+func (l *limiter) newConnSem() *connSem {
+	return new(connSem)
+}
+
+func (l *limiter) unlimited() bool {
+	return l.MaxInFlight <= 0 && l.MaxConnInFlight <= 0
+}
+
+// 是否有全局和连接级别的空闲名额， 调用时需持有l.mu
+func (l *limiter) available(conn *connSem) bool {
+	return (l.MaxInFlight <= 0 || l.inFlight < l.MaxInFlight) &&
+		(l.MaxConnInFlight <= 0 || conn.inFlight < l.MaxConnInFlight)
+}
+
+// acquire 为请求获取名额， 返回true表示已经获得名额， 由调用方开始处理请求；
+// 没有名额时按照策略让w排队并返回false， 之后由limiter调用w.start；
+// 不能排队时返回ErrServerBusy。 ctx有截止时间时排队的请求到期后以ErrDeadlineExceeded移出队列
+func (l *limiter) acquire(ctx context.Context, w *waiter) (bool, error) {
+	if l.unlimited() {
+		return true, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	//排队的请求在名额释放时已经被启动， 队列中剩下的请求都还没有名额
+	if l.available(w.conn) {
+		l.inFlight++
+		w.conn.inFlight++
+		return true, nil
+	}
+	if l.Policy != QueueWhenBusy || len(l.queue) >= l.QueueSize {
+		return false, ErrServerBusy
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		w.timer = time.AfterFunc(time.Until(deadline), func() {
+			l.cancel(w, ErrDeadlineExceeded)
+		})
+	}
+	l.queue = append(l.queue, w)
+	return false, nil
+}
+
+// cancel 将还在排队的w移出队列， 并以err调用w.start
+func (l *limiter) cancel(w *waiter, err error) {
+	l.mu.Lock()
+	removed := l.remove(func(q *waiter) bool { return q == w })
+	l.mu.Unlock()
+	for _, q := range removed {
+		//cancel可能在持有serverConn.mu时被调用， start需要在新的goroutine中执行
+		go q.start(err)
+	}
+}
+
+// drop 在连接断开时移出这个连接上所有排队的请求
+func (l *limiter) drop(conn *connSem) {
+	if l.unlimited() {
+		return
+	}
+	l.mu.Lock()
+	removed := l.remove(func(q *waiter) bool { return q.conn == conn })
+	l.mu.Unlock()
+	for _, q := range removed {
+		q.start(ErrShutdown)
+	}
+}
+
+// remove 移出队列中满足match的请求并停止它们的计时器， 调用时需持有l.mu
+func (l *limiter) remove(match func(*waiter) bool) (removed []*waiter) {
+	queue := l.queue[:0]
+	for _, q := range l.queue {
+		if !match(q) {
+			queue = append(queue, q)
+			continue
+		}
+		if q.timer != nil {
+			q.timer.Stop()
+		}
+		removed = append(removed, q)
+	}
+	for i := len(queue); i < len(l.queue); i++ {
+		l.queue[i] = nil
+	}
+	l.queue = queue
+	return
+}
+
+// release 释放一个名额， 并按到达顺序启动现在可以执行的排队请求
+func (l *limiter) release(conn *connSem) {
+	if l.unlimited() {
+		return
+	}
+	l.mu.Lock()
+	l.inFlight--
+	conn.inFlight--
+	ready := l.remove(func(q *waiter) bool {
+		if !l.available(q.conn) {
+			return false
+		}
+		l.inFlight++
+		q.conn.inFlight++
+		return true
+	})
+	l.mu.Unlock()
+	for _, q := range ready {
+		go q.start(nil)
+	}
+}
+
+// SetLimits 设置服务器同时处理的请求数上限，
+// 已经建立的连接仍然使用原来的连接级别上限
+func (server *Server) SetLimits(l Limits) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.limiter = newLimiter(l)
+}
+
+func (server *Server) getLimiter() *limiter {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.limiter == nil {
+		server.limiter = newLimiter(Limits{})
+	}
+	return server.limiter
+}
@@ -21,8 +21,13 @@ func (f Foo) Sum(args Args, reply *int) error {
 	return nil
 }
 
-func (f Foo) Sleep(args Args, reply *int) error {
-	time.Sleep(time.Second * time.Duration(args.Num1))
+func (f Foo) Sleep(ctx context.Context, args Args, reply *int) error {
+	select {
+	case <-time.After(time.Second * time.Duration(args.Num1)):
+	case <-ctx.Done():
+		// the caller has gone away, stop sleeping
+		return ctx.Err()
+	}
 	*reply = args.Num1 + args.Num2
 	return nil
 }
@@ -0,0 +1,90 @@
+package geerpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Metadata 是随请求和响应一起传输的键值对， 保存在codec.Header中，
+// 可以用来传递trace id、认证token、调用方身份等与业务参数无关的信息
+type Metadata map[string]string
+
+// Copy 返回md的拷贝
+func (md Metadata) Copy() Metadata {
+	if md == nil {
+		return nil
+	}
+	out := make(Metadata, len(md))
+	for k, v := range md {
+		out[k] = v
+	}
+	return out
+}
+
+type (
+	outgoingMetadataKey struct{}
+	incomingMetadataKey struct{}
+	replyMetadataKey    struct{}
+	replySinkKey        struct{}
+)
+
+// NewOutgoingContext 返回携带md的ctx， 使用该ctx的Client.Call会将md随请求发送给服务端
+func NewOutgoingContext(ctx context.Context, md Metadata) context.Context {
+	return context.WithValue(ctx, outgoingMetadataKey{}, md)
+}
+
+// FromOutgoingContext 返回ctx中将要发送给服务端的元数据
+func FromOutgoingContext(ctx context.Context) (Metadata, bool) {
+	md, ok := ctx.Value(outgoingMetadataKey{}).(Metadata)
+	return md, ok
+}
+
+// FromIncomingContext 在服务端方法中返回客户端随请求发送的元数据
+func FromIncomingContext(ctx context.Context) (Metadata, bool) {
+	md, ok := ctx.Value(incomingMetadataKey{}).(Metadata)
+	return md, ok
+}
+
+// replyMetadata 收集服务端方法设置的响应元数据
+type replyMetadata struct {
+	mu sync.Mutex
+	md Metadata
+}
+
+// 为一次请求创建服务端方法使用的ctx
+func newIncomingContext(ctx context.Context, md Metadata) (context.Context, *replyMetadata) {
+	reply := new(replyMetadata)
+	ctx = context.WithValue(ctx, incomingMetadataKey{}, md)
+	return context.WithValue(ctx, replyMetadataKey{}, reply), reply
+}
+
+func (r *replyMetadata) get() Metadata {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.md
+}
+
+var errNoReplyMetadata = errors.New("rpc server: context has no reply metadata, it is not passed to a service method")
+
+// SetReplyMetadata 在服务端方法中设置随响应返回给客户端的元数据， 多次调用会合并
+func SetReplyMetadata(ctx context.Context, md Metadata) error {
+	r, ok := ctx.Value(replyMetadataKey{}).(*replyMetadata)
+	if !ok {
+		return errNoReplyMetadata
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.md == nil {
+		r.md = make(Metadata, len(md))
+	}
+	for k, v := range md {
+		r.md[k] = v
+	}
+	return nil
+}
+
+// WithReplyMetadata 返回的ctx用于Client.Call时， 调用完成后服务端返回的元数据会保存到md中
+func WithReplyMetadata(ctx context.Context, md *Metadata) context.Context {
+	return context.WithValue(ctx, replySinkKey{}, md)
+}
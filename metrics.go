@@ -0,0 +1,218 @@
+package geerpc
+
+import (
+	"bufio"
+	"fmt"
+	"geerpc/codec"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const defaultMetricsPath = "/metrics"
+
+// MetricsWriter 以Prometheus文本格式输出指标， Server和xclient.Metrics都实现了这个接口
+type MetricsWriter interface {
+	WriteMetrics(w io.Writer)
+}
+
+// traffic 统计一种编解码类型的连接上读写的字节数
+type traffic struct {
+	read, written uint64
+}
+
+// countingConn 统计经过连接的字节数
+type countingConn struct {
+	io.ReadWriteCloser
+	t *traffic
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	atomic.AddUint64(&c.t.read, uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	atomic.AddUint64(&c.t.written, uint64(n))
+	return n, err
+}
+
+// rejection 是一类没有交给服务方法处理就返回了错误的请求，
+// 服务或方法不存在时对应的名称为空， 避免客户端发送的任意名称成为标签值
+type rejection struct {
+	service, method string
+	code            Code
+}
+
+// 统计一个被拒绝的请求， req为nil表示还没有解析出服务和方法
+func (server *Server) countRejected(req *request, err error) {
+	r := rejection{code: ErrorCode(err)}
+	if req != nil && req.svc != nil {
+		r.service = req.svc.name
+		if req.mtype != nil {
+			r.method = req.mtype.method.Name
+		}
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.rejected == nil {
+		server.rejected = make(map[rejection]uint64)
+	}
+	server.rejected[r]++
+}
+
+// 返回编解码类型对应的字节统计
+func (server *Server) getTraffic(typ codec.Type) *traffic {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.traffic == nil {
+		server.traffic = make(map[codec.Type]*traffic)
+	}
+	t, ok := server.traffic[typ]
+	if !ok {
+		t = new(traffic)
+		server.traffic[typ] = t
+	}
+	return t
+}
+
+// WriteMetrics 以Prometheus文本格式输出服务器的指标：
+// 按服务、方法和状态统计的请求数（被拒绝的请求以错误码作为状态）， 处理耗时直方图， 正在处理的请求数，
+// 按编解码类型统计的读写字节数， 以及当前的连接数
+func (server *Server) WriteMetrics(w io.Writer) {
+	stats := server.Stats()
+
+	writeHeader(w, "geerpc_server_requests_total", "counter", "Number of handled requests by service, method and status.")
+	for _, s := range stats.Services {
+		for _, m := range s.Methods {
+			var completed uint64
+			for _, n := range m.LatencyBuckets {
+				completed += n
+			}
+			ok := uint64(0)
+			if completed > m.Errors {
+				ok = completed - m.Errors
+			}
+			fmt.Fprintf(w, "geerpc_server_requests_total{service=\"%s\",method=\"%s\",status=\"ok\"} %d\n",
+				escapeLabel(s.Name), escapeLabel(m.Name), ok)
+			fmt.Fprintf(w, "geerpc_server_requests_total{service=\"%s\",method=\"%s\",status=\"error\"} %d\n",
+				escapeLabel(s.Name), escapeLabel(m.Name), m.Errors)
+		}
+	}
+	server.mu.Lock()
+	rejections := make([]rejection, 0, len(server.rejected))
+	counts := make(map[rejection]uint64, len(server.rejected))
+	for r, n := range server.rejected {
+		rejections = append(rejections, r)
+		counts[r] = n
+	}
+	server.mu.Unlock()
+	sort.Slice(rejections, func(i, j int) bool {
+		a, b := rejections[i], rejections[j]
+		if a.service != b.service {
+			return a.service < b.service
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+	for _, r := range rejections {
+		fmt.Fprintf(w, "geerpc_server_requests_total{service=\"%s\",method=\"%s\",status=\"%s\"} %d\n",
+			escapeLabel(r.service), escapeLabel(r.method), r.code, counts[r])
+	}
+
+	writeHeader(w, "geerpc_server_panics_total", "counter", "Number of recovered panics by service and method.")
+	for _, s := range stats.Services {
+		for _, m := range s.Methods {
+			fmt.Fprintf(w, "geerpc_server_panics_total{service=\"%s\",method=\"%s\"} %d\n",
+				escapeLabel(s.Name), escapeLabel(m.Name), m.Panics)
+		}
+	}
+
+	writeHeader(w, "geerpc_server_handling_seconds", "histogram", "Time spent in service methods.")
+	for _, s := range stats.Services {
+		for _, m := range s.Methods {
+			labels := fmt.Sprintf("service=\"%s\",method=\"%s\"", escapeLabel(s.Name), escapeLabel(m.Name))
+			var cumulative uint64
+			for i, n := range m.LatencyBuckets {
+				cumulative += n
+				le := "+Inf"
+				if i < len(latencyBuckets) {
+					le = formatFloat(latencyBuckets[i].Seconds())
+				}
+				fmt.Fprintf(w, "geerpc_server_handling_seconds_bucket{%s,le=\"%s\"} %d\n", labels, le, cumulative)
+			}
+			fmt.Fprintf(w, "geerpc_server_handling_seconds_sum{%s} %s\n", labels, formatFloat(m.TotalLatency.Seconds()))
+			fmt.Fprintf(w, "geerpc_server_handling_seconds_count{%s} %d\n", labels, cumulative)
+		}
+	}
+
+	writeHeader(w, "geerpc_server_in_flight", "gauge", "Number of requests being handled by service and method.")
+	for _, s := range stats.Services {
+		for _, m := range s.Methods {
+			fmt.Fprintf(w, "geerpc_server_in_flight{service=\"%s\",method=\"%s\"} %d\n",
+				escapeLabel(s.Name), escapeLabel(m.Name), m.InFlight)
+		}
+	}
+
+	server.mu.Lock()
+	types := make([]string, 0, len(server.traffic))
+	traffic := make(map[string]*traffic, len(server.traffic))
+	for typ, t := range server.traffic {
+		types = append(types, string(typ))
+		traffic[string(typ)] = t
+	}
+	server.mu.Unlock()
+	sort.Strings(types)
+	writeHeader(w, "geerpc_server_read_bytes_total", "counter", "Bytes read from connections by codec.")
+	for _, typ := range types {
+		fmt.Fprintf(w, "geerpc_server_read_bytes_total{codec=\"%s\"} %d\n", escapeLabel(typ), atomic.LoadUint64(&traffic[typ].read))
+	}
+	writeHeader(w, "geerpc_server_written_bytes_total", "counter", "Bytes written to connections by codec.")
+	for _, typ := range types {
+		fmt.Fprintf(w, "geerpc_server_written_bytes_total{codec=\"%s\"} %d\n", escapeLabel(typ), atomic.LoadUint64(&traffic[typ].written))
+	}
+
+	writeHeader(w, "geerpc_server_connections", "gauge", "Number of active connections.")
+	fmt.Fprintf(w, "geerpc_server_connections %d\n", len(stats.Connections))
+}
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// Prometheus文本格式的标签值只转义反斜杠、双引号和换行
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// MetricsHandler 返回以Prometheus文本格式输出指标的http.Handler，
+// 包括服务器自身和writers的指标， 例如xclient.Metrics
+func (server *Server) MetricsHandler(writers ...MetricsWriter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		server.WriteMetrics(bw)
+		for _, mw := range writers {
+			mw.WriteMetrics(bw)
+		}
+		_ = bw.Flush()
+	})
+}
+
+// HandleMetrics 在/metrics上注册DefaultServer的MetricsHandler
+func HandleMetrics(writers ...MetricsWriter) {
+	http.Handle(defaultMetricsPath, DefaultServer.MetricsHandler(writers...))
+}
@@ -0,0 +1,72 @@
+package geerpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeMetrics string
+
+func (m fakeMetrics) WriteMetrics(w io.Writer) {
+	fmt.Fprintln(w, string(m))
+}
+
+func TestServer_MetricsHandler(t *testing.T) {
+	t.Parallel()
+	server := NewServer()
+	_ = server.Register(&Flaky{})
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+	for i := 0; i < 3; i++ {
+		var reply string
+		_ = client.Call(context.Background(), "Flaky.Hello", "gee", &reply)
+	}
+	// rejected requests are counted by error code
+	var reply string
+	_ = client.Call(context.Background(), "Flaky.Missing", "gee", &reply)
+	_ = client.Call(context.Background(), "Missing.Hello", "gee", &reply)
+	_ = client.Call(context.Background(), "Missing.Hello", "gee", &reply)
+
+	w := httptest.NewRecorder()
+	server.MetricsHandler(fakeMetrics("extra_metric 1")).ServeHTTP(w, httptest.NewRequest("GET", defaultMetricsPath, nil))
+	_assert(strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain"), "expect the text format")
+	body := w.Body.String()
+	for _, want := range []string{
+		"# TYPE geerpc_server_requests_total counter\n",
+		`geerpc_server_requests_total{service="Flaky",method="Hello",status="ok"} 1` + "\n",
+		`geerpc_server_requests_total{service="Flaky",method="Hello",status="error"} 2` + "\n",
+		`geerpc_server_requests_total{service="Flaky",method="",status="not_found"} 1` + "\n",
+		`geerpc_server_requests_total{service="",method="",status="not_found"} 2` + "\n",
+		"# TYPE geerpc_server_handling_seconds histogram\n",
+		`geerpc_server_handling_seconds_bucket{service="Flaky",method="Hello",le="+Inf"} 3` + "\n",
+		`geerpc_server_handling_seconds_count{service="Flaky",method="Hello"} 3` + "\n",
+		`geerpc_server_in_flight{service="Flaky",method="Hello"} 0` + "\n",
+		`geerpc_server_read_bytes_total{codec="application/gob"} `,
+		`geerpc_server_written_bytes_total{codec="application/gob"} `,
+		"geerpc_server_connections 1\n",
+		"extra_metric 1\n",
+	} {
+		_assert(strings.Contains(body, want), "expect %q in metrics:\n%s", want, body)
+	}
+	_assert(!strings.Contains(body, `geerpc_server_read_bytes_total{codec="application/gob"} 0`), "expect bytes to be counted")
+}
+
+func TestEscapeLabel(t *testing.T) {
+	for v, want := range map[string]string{
+		`plain`:     `plain`,
+		`a"b`:       `a\"b`,
+		`a\b`:       `a\\b`,
+		"a\nb":      `a\nb`,
+		"tab\there": "tab\there",
+		"中文":        "中文",
+	} {
+		_assert(escapeLabel(v) == want, "escapeLabel(%q) = %q, want %q", v, escapeLabel(v), want)
+	}
+}
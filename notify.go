@@ -0,0 +1,110 @@
+package geerpc
+
+import (
+	"context"
+	"errors"
+	"geerpc/codec"
+	"log"
+	"reflect"
+)
+
+// 服务端推送的通知使用MsgNotify消息， ServiceMethod字段为事件名， Seq为0，
+// 不对应任何请求， 因此不会影响客户端按Seq匹配响应
+
+// Conn 表示服务端上的一个客户端连接， 服务方法可以通过ConnFromContext获得，
+// 保存下来之后即可在任何时候向这个客户端推送通知
+type Conn struct {
+	sc   *serverConn
+	done <-chan struct{}
+}
+
+type connKey struct{}
+
+// ConnFromContext 返回处理当前请求的连接
+func ConnFromContext(ctx context.Context) (*Conn, bool) {
+	c, ok := ctx.Value(connKey{}).(*Conn)
+	return c, ok
+}
+
+// Notify 向客户端推送一条通知， 客户端通过Client.HandleNotification注册的处理函数接收
+func (c *Conn) Notify(event string, body interface{}) error {
+	select {
+	case <-c.done:
+		return ErrShutdown
+	default:
+	}
+	h := &codec.Header{ServiceMethod: event, Type: codec.MsgNotify}
+	return c.sc.server.sendResponse(c.sc, h, body)
+}
+
+// Done 返回的channel在连接断开后被关闭
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Broadcast 向所有连接推送一条通知
+func (server *Server) Broadcast(event string, body interface{}) {
+	server.mu.Lock()
+	conns := make([]*Conn, 0, len(server.conns))
+	for sc := range server.conns {
+		conns = append(conns, sc.conn)
+	}
+	server.mu.Unlock()
+	for _, c := range conns {
+		_ = c.Notify(event, body)
+	}
+}
+
+// HandleNotification 注册事件event的处理函数， handler的类型为func(T)，
+// 收到的通知消息体解码为T之后调用handler， 使用protobuf编解码时T应为proto消息的指针。
+// handler在读取响应的goroutine中按收到的顺序调用， 不应阻塞， 也不能在其中等待同一个Client上的调用
+func (client *Client) HandleNotification(event string, handler interface{}) error {
+	fn := reflect.ValueOf(handler)
+	if fn.Kind() != reflect.Func || fn.Type().NumIn() != 1 || fn.Type().NumOut() != 0 {
+		return errors.New("rpc client: notification handler must be func(T)")
+	}
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.handlers == nil {
+		client.handlers = make(map[string]reflect.Value)
+	}
+	client.handlers[event] = fn
+	return nil
+}
+
+// 读取并分发一条通知， 没有注册处理函数的通知被丢弃
+func (client *Client) dispatchNotification(h *codec.Header) error {
+	client.mu.Lock()
+	fn, ok := client.handlers[h.ServiceMethod]
+	client.mu.Unlock()
+	if !ok {
+		return client.cc.ReadBody(nil)
+	}
+	// 与服务方法的参数一样， 指针类型的T直接解码到新建的值，
+	// protobuf编解码要求解码的目标是proto.Message， 因此不能解码到**T
+	typ := fn.Type().In(0)
+	var argv reflect.Value
+	if typ.Kind() == reflect.Ptr {
+		argv = reflect.New(typ.Elem())
+	} else {
+		argv = reflect.New(typ)
+	}
+	if err := client.cc.ReadBody(argv.Interface()); err != nil {
+		if errors.Is(err, codec.ErrBodyType) {
+			// 消息体已经读出， 丢弃这条通知， 连接仍然可以使用
+			log.Printf("rpc client: can't decode notification %s: %v", h.ServiceMethod, err)
+			return nil
+		}
+		return err
+	}
+	if typ.Kind() != reflect.Ptr {
+		argv = argv.Elem()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("rpc client: panic in notification handler %s: %v", h.ServiceMethod, r)
+		}
+	}()
+	fn.Call([]reflect.Value{argv})
+	return nil
+}
@@ -0,0 +1,150 @@
+package geerpc
+
+import (
+	"context"
+	"geerpc/codec"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type Audit struct {
+	events chan string
+	conns  chan *Conn
+}
+
+func (a *Audit) Record(event string, reply *struct{}) error {
+	a.events <- event
+	return nil
+}
+
+func (a *Audit) Subscribe(ctx context.Context, topic string, reply *string) error {
+	conn, ok := ConnFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	a.conns <- conn
+	*reply = topic
+	return nil
+}
+
+func TestClient_CallOneWay(t *testing.T) {
+	t.Parallel()
+	audit := &Audit{events: make(chan string, 1), conns: make(chan *Conn, 1)}
+	server := NewServer()
+	_ = server.Register(audit)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+
+	for _, typ := range []codec.Type{codec.GobType, codec.JsonType} {
+		t.Run(string(typ), func(t *testing.T) {
+			client, _ := Dial("tcp", l.Addr().String(), &Option{CodecType: typ})
+			defer func() { _ = client.Close() }()
+			ctx := context.Background()
+
+			_assert(client.CallOneWay(ctx, "Audit.Record", "login") == nil, "failed to send one-way call")
+			select {
+			case event := <-audit.events:
+				_assert(event == "login", "expect login, but got %s", event)
+			case <-time.After(time.Second):
+				t.Fatal("expect the one-way call to be handled")
+			}
+			// errors of one-way calls are not sent back
+			_assert(client.CallOneWay(ctx, "Audit.Unknown", "login") == nil, "failed to send one-way call")
+			var reply string
+			err := client.Call(ctx, "Audit.Subscribe", "news", &reply)
+			_assert(err == nil && reply == "news", "connection broken after one-way calls: %v", err)
+			client.mu.Lock()
+			_assert(len(client.pending) == 0, "one-way calls must not be pending")
+			client.mu.Unlock()
+			<-audit.conns
+		})
+	}
+}
+
+// Feed 与Audit.Subscribe相同， 参数和返回值是proto.Message， 用于protobuf编解码
+type Feed struct{ conns chan *Conn }
+
+func (f *Feed) Subscribe(ctx context.Context, topic *wrapperspb.StringValue, reply *wrapperspb.StringValue) error {
+	conn, _ := ConnFromContext(ctx)
+	f.conns <- conn
+	reply.Value = topic.Value
+	return nil
+}
+
+func TestServer_Notify(t *testing.T) {
+	t.Parallel()
+	audit := &Audit{events: make(chan string, 1), conns: make(chan *Conn, 1)}
+	server := NewServer()
+	_ = server.Register(audit)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+
+	for _, typ := range []codec.Type{codec.GobType, codec.JsonType} {
+		t.Run(string(typ), func(t *testing.T) {
+			client, _ := Dial("tcp", l.Addr().String(), &Option{CodecType: typ})
+			defer func() { _ = client.Close() }()
+			_assert(client.HandleNotification("news", "not a func") != nil, "expect an invalid handler error")
+			news := make(chan string, 2)
+			_ = client.HandleNotification("news", func(s string) { news <- s })
+
+			var reply string
+			_ = client.Call(context.Background(), "Audit.Subscribe", "news", &reply)
+			conn := <-audit.conns
+			_assert(conn.Notify("news", "hello") == nil, "failed to notify")
+			_assert(conn.Notify("weather", "sunny") == nil, "failed to notify")
+			server.Broadcast("news", "everyone")
+			for _, want := range []string{"hello", "everyone"} {
+				select {
+				case got := <-news:
+					_assert(got == want, "expect %s, but got %s", want, got)
+				case <-time.After(time.Second):
+					t.Fatalf("expect notification %s", want)
+				}
+			}
+			// notifications don't disturb the replies of pending calls
+			err := client.Call(context.Background(), "Audit.Subscribe", "sports", &reply)
+			_assert(err == nil && reply == "sports", "failed to call after notifications: %v", err)
+			<-audit.conns
+
+			_ = client.Close()
+			select {
+			case <-conn.Done():
+			case <-time.After(time.Second):
+				t.Fatal("expect the connection to be done")
+			}
+			_assert(conn.Notify("news", "bye") == ErrShutdown, "expect ErrShutdown")
+		})
+	}
+}
+
+func TestServer_NotifyProtobuf(t *testing.T) {
+	t.Parallel()
+	feed := &Feed{conns: make(chan *Conn, 1)}
+	server := NewServer()
+	_ = server.Register(feed)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	client, _ := Dial("tcp", l.Addr().String(), &Option{CodecType: codec.ProtobufType})
+	defer func() { _ = client.Close() }()
+
+	news := make(chan string, 1)
+	_ = client.HandleNotification("news", func(s *wrapperspb.StringValue) { news <- s.Value })
+	// protobuf can't decode into a string, the notification is dropped
+	_ = client.HandleNotification("weather", func(s string) { news <- s })
+	reply := &wrapperspb.StringValue{}
+	_ = client.Call(context.Background(), "Feed.Subscribe", wrapperspb.String("news"), reply)
+	conn := <-feed.conns
+	_assert(conn.Notify("weather", wrapperspb.String("sunny")) == nil, "failed to notify")
+	_assert(conn.Notify("news", wrapperspb.String("hello")) == nil, "failed to notify")
+	select {
+	case got := <-news:
+		_assert(got == "hello", "expect hello, but got %s", got)
+	case <-time.After(time.Second):
+		t.Fatal("expect the notification")
+	}
+	err := client.Call(context.Background(), "Feed.Subscribe", wrapperspb.String("sports"), reply)
+	_assert(err == nil && reply.Value == "sports", "failed to call after notifications: %v", err)
+}
@@ -0,0 +1,128 @@
+package geerpc
+
+import (
+	"context"
+	"reflect"
+	"sort"
+)
+
+// ReflectionService 是反射服务的名称， 通过Server.RegisterReflection注册
+const ReflectionService = "Reflection"
+
+// ServiceDesc 描述一个已注册的服务
+type ServiceDesc struct {
+	Name    string
+	Methods []MethodDesc
+}
+
+// MethodDesc 描述服务的一个方法
+type MethodDesc struct {
+	Name      string
+	Stream    bool      // 是否为流式方法
+	ArgType   *TypeDesc // 参数类型， 流式方法中客户端发送的所有消息都是这个类型
+	ReplyType *TypeDesc // 返回值类型， 流式方法发送的消息类型不固定， 为nil
+}
+
+// TypeDesc 是Go类型的结构化描述， 不需要类型定义就可以构造参数、解析返回值
+type TypeDesc struct {
+	Name      string      // 类型的完整名称， 如"geerpc.Args"、"[]int"
+	Kind      string      // reflect.Kind的名称， 如"struct"、"ptr"、"map"
+	Elem      *TypeDesc   // ptr、slice、array、map的元素类型
+	Key       *TypeDesc   // map的key类型
+	Len       int         // array的长度
+	Fields    []FieldDesc // struct的导出字段
+	Recursive bool        // struct在外层已经出现过， 不再展开， 根据Name找到外层的描述
+}
+
+// FieldDesc 描述struct的一个导出字段
+type FieldDesc struct {
+	Name string
+	Tag  string // 完整的struct tag， 如`json:"name"`
+	Type *TypeDesc
+}
+
+// Reflection 是内置的反射服务， Reflection.Describe返回服务及其方法的描述，
+// 参数为服务名， 为空时返回所有服务
+type Reflection struct {
+	server *Server
+}
+
+// RegisterReflection 在服务器上注册反射服务Reflection， 客户端可以据此查询所有服务的方法和参数类型，
+// 已经有同名的服务时返回错误
+func (server *Server) RegisterReflection() error {
+	return server.Register(&Reflection{server: server})
+}
+
+// Describe 按名称顺序返回服务的描述
+func (r *Reflection) Describe(name string, reply *[]ServiceDesc) error {
+	var services []*service
+	r.server.serviceMap.Range(func(_, v interface{}) bool {
+		if s := v.(*service); name == "" || s.name == name {
+			services = append(services, s)
+		}
+		return true
+	})
+	if len(services) == 0 && name != "" {
+		return NewError(CodeNotFound, "rpc server: reflection: unknown service "+name)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].name < services[j].name })
+	for _, s := range services {
+		*reply = append(*reply, describeService(s))
+	}
+	return nil
+}
+
+func describeService(s *service) ServiceDesc {
+	desc := ServiceDesc{Name: s.name}
+	for name, m := range s.method {
+		md := MethodDesc{
+			Name:    name,
+			Stream:  m.stream,
+			ArgType: describeType(m.ArgType, make(map[reflect.Type]bool)),
+		}
+		if !m.stream {
+			md.ReplyType = describeType(m.ReplyType, make(map[reflect.Type]bool))
+		}
+		desc.Methods = append(desc.Methods, md)
+	}
+	sort.Slice(desc.Methods, func(i, j int) bool { return desc.Methods[i].Name < desc.Methods[j].Name })
+	return desc
+}
+
+// describeType 递归地描述类型t， path记录外层正在展开的struct， 避免递归类型无限展开
+func describeType(t reflect.Type, path map[reflect.Type]bool) *TypeDesc {
+	d := &TypeDesc{Name: t.String(), Kind: t.Kind().String()}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		d.Elem = describeType(t.Elem(), path)
+	case reflect.Array:
+		d.Len = t.Len()
+		d.Elem = describeType(t.Elem(), path)
+	case reflect.Map:
+		d.Key = describeType(t.Key(), path)
+		d.Elem = describeType(t.Elem(), path)
+	case reflect.Struct:
+		if path[t] {
+			d.Recursive = true
+			return d
+		}
+		path[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				// 未导出的字段不会被编解码
+				continue
+			}
+			d.Fields = append(d.Fields, FieldDesc{Name: f.Name, Tag: string(f.Tag), Type: describeType(f.Type, path)})
+		}
+		delete(path, t)
+	}
+	return d
+}
+
+// Describe 调用服务端的Reflection.Describe， service为空时返回所有服务
+func (client *Client) Describe(ctx context.Context, service string) ([]ServiceDesc, error) {
+	var services []ServiceDesc
+	err := client.Call(ctx, ReflectionService+".Describe", service, &services)
+	return services, err
+}
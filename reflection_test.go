@@ -0,0 +1,79 @@
+package geerpc
+
+import (
+	"context"
+	"geerpc/codec"
+	"net"
+	"testing"
+)
+
+type Tree struct {
+	Value    int `json:"value"`
+	Children []*Tree
+	Labels   map[string][2]string
+	size     int
+}
+
+type Forest int
+
+func (f Forest) Size(tree *Tree, reply *int) error {
+	*reply = 1
+	for _, child := range tree.Children {
+		var n int
+		_ = f.Size(child, &n)
+		*reply += n
+	}
+	return nil
+}
+
+func TestClient_Describe(t *testing.T) {
+	t.Parallel()
+	server := NewServer()
+	_ = server.RegisterReflection()
+	var forest Forest
+	_ = server.Register(&forest)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+
+	for _, typ := range []codec.Type{codec.GobType, codec.JsonType, codec.MsgpackType} {
+		t.Run(string(typ), func(t *testing.T) {
+			client, _ := Dial("tcp", l.Addr().String(), &Option{CodecType: typ})
+			defer func() { _ = client.Close() }()
+
+			services, err := client.Describe(context.Background(), "")
+			_assert(err == nil && len(services) == 3, "expect 3 services, got %d, %v", len(services), err)
+			_assert(services[0].Name == "Forest" && services[1].Name == "Health" && services[2].Name == "Reflection",
+				"expect services sorted by name")
+			health := services[1]
+			_assert(len(health.Methods) == 2 && health.Methods[1].Name == "Watch" && health.Methods[1].Stream,
+				"expect Health.Watch to be a streaming method")
+
+			services, err = client.Describe(context.Background(), "Forest")
+			_assert(err == nil && len(services) == 1, "expect only Forest, got %v", err)
+			size := services[0].Methods[0]
+			_assert(size.Name == "Size" && !size.Stream, "expect Forest.Size")
+			_assert(size.ReplyType.Name == "*int" && size.ReplyType.Elem.Kind == "int", "wrong reply type %+v", size.ReplyType)
+			arg := size.ArgType
+			_assert(arg.Kind == "ptr" && arg.Elem.Name == "geerpc.Tree", "wrong arg type %+v", arg)
+			tree := arg.Elem
+			_assert(tree.Kind == "struct" && len(tree.Fields) == 3, "expect 3 exported fields, got %d", len(tree.Fields))
+			_assert(tree.Fields[0].Name == "Value" && tree.Fields[0].Tag == `json:"value"`, "wrong field %+v", tree.Fields[0])
+			children := tree.Fields[1].Type
+			_assert(children.Kind == "slice" && children.Elem.Elem.Recursive, "expect the nested tree not to be expanded")
+			labels := tree.Fields[2].Type
+			_assert(labels.Key.Kind == "string" && labels.Elem.Kind == "array" && labels.Elem.Len == 2,
+				"wrong map type %+v", labels)
+
+			_, err = client.Describe(context.Background(), "Unknown")
+			_assert(err != nil, "expect an unknown service error")
+		})
+	}
+}
+
+func TestServer_RegisterReflection(t *testing.T) {
+	server := NewServer()
+	_, _, err := server.findService(ReflectionService + ".Describe")
+	_assert(err != nil, "expect no reflection service by default")
+	_assert(server.RegisterReflection() == nil, "failed to register reflection")
+	_assert(server.RegisterReflection() != nil, "expect a duplicate service error")
+}
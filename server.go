@@ -5,17 +5,22 @@
 package geerpc
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"geerpc/codec"
 	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -29,6 +34,28 @@ type Option struct {
 	CodecType      codec.Type    // 客户端选择编解码类型
 	ConnectTimeout time.Duration // 链接超时时间
 	HandleTimeout  time.Duration //处理请求超时时间
+
+	Compression       codec.Compression // 压缩算法， 为空表示不压缩
+	CompressThreshold int               // 消息长度达到该值才压缩， 为0时使用codec.DefaultCompressThreshold
+
+	// 客户端拦截器， 只在客户端生效， 不会发送给服务端
+	Interceptors []ClientInterceptor `json:"-"`
+	// 客户端的TLS配置， 不为nil时Dial、DialHTTP使用TLS连接服务端；
+	// 双向认证时在Certificates中设置客户端证书， RootCAs为验证服务端证书的CA
+	TLSConfig *tls.Config `json:"-"`
+
+	// 客户端的认证凭证， 不为nil时建立连接时与服务端完成认证， AuthScheme由它自动设置
+	Credentials Credentials `json:"-"`
+	AuthScheme  string      // 客户端使用的认证方式， 为空表示不认证
+}
+
+//根据option选择编解码方法， 需要压缩时在外层包装压缩
+func (opt *Option) newCodecFunc() (codec.NewCodecFunc, error) {
+	f := codec.NewCodecFuncMap[opt.CodecType]
+	if f == nil {
+		return nil, fmt.Errorf("invalid codec type %s", opt.CodecType)
+	}
+	return codec.WithCompression(f, opt.Compression, opt.CompressThreshold)
 }
 
 //默认option， 解码类型为gob 默认连接超时时间为10秒
@@ -43,11 +70,30 @@ var DefaultOption = &Option{
 type Server struct {
 	//map key类型是 servicename string ， value是 *service
 	serviceMap sync.Map
+
+	mu         sync.Mutex // protect following
+	listeners  map[net.Listener]struct{}
+	conns      map[*serverConn]struct{}
+	inShutdown bool // Shutdown或Close已经被调用
+
+	interceptors []ServerInterceptor
+	limiter      *limiter
+	health       *Health
+	traffic      map[codec.Type]*traffic // 按编解码类型统计的读写字节数
+	rejected     map[rejection]uint64    // 没有交给服务方法处理的请求数
+
+	authenticators map[string]Authenticator // 以认证方式的名称为key， 为空表示不需要认证
+	authorizer     Authorizer
+	tlsConfig      *tls.Config // 不为nil时Accept接受的连接都使用TLS
+
+	handshakeTimeout time.Duration // 等待Option和认证完成的时间， 0表示使用handshakeTimeout
 }
 
-// 新建一个server实例
+// 新建一个server实例， 并注册内置的健康检查服务Health
 func NewServer() *Server {
-	return &Server{}
+	server := &Server{}
+	_ = server.RegisterHealth()
+	return server
 }
 
 // 默认server实例， 对外部包表现为单例类型
@@ -59,9 +105,24 @@ var DefaultServer = NewServer()
 //ServerConn 在单个连接上运行服务器 并阻塞 为连接提供服务，直到客户端挂断
 func (server *Server) ServeConn(conn io.ReadWriteCloser) {
 	defer func() { _ = conn.Close() }()
+	p, err := handshake(conn)
+	if err != nil {
+		log.Printf("rpc server: tls handshake with %s error: %v", p.remote, err)
+		return
+	}
+	//Option和认证必须在限定时间内完成， 避免连接后不发送数据的客户端一直占用连接
+	nc, _ := conn.(net.Conn)
+	if nc != nil {
+		timeout := server.handshakeTimeout
+		if timeout == 0 {
+			timeout = handshakeTimeout
+		}
+		_ = nc.SetDeadline(time.Now().Add(timeout))
+	}
 	var opt Option
 	//首先对option消息进行解码， 第一个来的必定是option包
-	if err := json.NewDecoder(conn).Decode(&opt); err != nil {
+	dec := json.NewDecoder(conn)
+	if err := dec.Decode(&opt); err != nil {
 		log.Println("rpc server: options error: ", err)
 		return
 	}
@@ -69,40 +130,239 @@ func (server *Server) ServeConn(conn io.ReadWriteCloser) {
 		log.Printf("rpc server: invalid magic number %x", opt.MagicNumber)
 		return
 	}
-	//根据option中的内容选择合适的编解码类型实例
-	f := codec.NewCodecFuncMap[opt.CodecType]
-	if f == nil {
-		log.Printf("rpc server: invalid codec type %s", opt.CodecType)
+	//根据option中的内容选择合适的编解码类型实例和压缩算法
+	f, err := opt.newCodecFunc()
+	if err != nil {
+		log.Println("rpc server:", err)
 		return
 	}
+	//客户端提供了凭证时先完成认证， 否则以通过验证的客户端证书作为调用方身份
+	if opt.AuthScheme != "" {
+		if p.principal, err = server.authenticate(conn, dec, opt.AuthScheme); err != nil {
+			log.Printf("rpc server: authentication of %s failed: %v", p.remote, err)
+			return
+		}
+	} else {
+		p.principal = p.certPrincipal()
+	}
 	//创建codec实例并调用编解码过程 f（conn） 创建了实例
-	server.serveCodec(f(conn), &opt)
+	rwc := &countingConn{ReadWriteCloser: newBufferedConn(conn, dec), t: server.getTraffic(opt.CodecType)}
+	if required, _ := server.getAuthenticator(""); required && opt.AuthScheme == "" {
+		server.rejectUnauthenticated(f(rwc))
+		return
+	}
+	if nc != nil {
+		_ = nc.SetDeadline(time.Time{})
+	}
+	server.serveCodec(f(rwc), &opt, p)
+}
+
+//bufferedConn 读取时先返回握手阶段已经被缓冲的数据， 再从conn中继续读取
+type bufferedConn struct {
+	io.Reader
+	io.ReadWriteCloser
+}
+
+//json解码option时可能已经预读了后续的请求数据， 需要交还给codec
+//json.Encoder会在option之后追加一个换行符， 不属于codec的数据， 需要跳过
+func newBufferedConn(conn io.ReadWriteCloser, dec *json.Decoder) *bufferedConn {
+	buffered, _ := ioutil.ReadAll(dec.Buffered())
+	buffered = bytes.TrimPrefix(buffered, []byte("\n"))
+	return &bufferedConn{
+		Reader:          io.MultiReader(bytes.NewReader(buffered), conn),
+		ReadWriteCloser: conn,
+	}
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.Reader.Read(p)
 }
 
 // 当有error出现时返回这个无效空请求
 var invalidRequest = struct{}{}
 
+// ErrDeadlineExceeded 表示请求没有在截止时间内处理完成，
+// 截止时间取Option.HandleTimeout和客户端ctx的deadline中较早的一个
+var ErrDeadlineExceeded error = NewError(CodeDeadlineExceeded, "rpc server: request handle timeout: deadline exceeded")
+
+//serverConn 保存一个连接上的状态
+type serverConn struct {
+	numCalls uint64 // 连接上收到的请求数， 原子操作的64位字段放在最前面以保证32位平台上的对齐
+	lastRead int64  // 最近一次读到请求头的时间（UnixNano）， 优雅关闭时据此判断连接是否空闲
+
+	server  *Server
+	conn    *Conn // 交给服务方法用于推送通知
+	cc      codec.Codec
+	opt     *Option
+	sending sync.Mutex     // make sure to send a complete response
+	wg      sync.WaitGroup // wait until all request are handled
+	active  int32          // 正在读取、处理的请求和仍在运行的服务方法数， 优雅关闭时据此判断连接是否空闲
+	lim     *limiter       // 建立连接时服务器的限流设置
+	sem     *connSem       // 连接级别的名额
+	mu      sync.Mutex     // protect following
+	// 正在处理的请求， 用于响应客户端的取消消息
+	inflight map[uint64]context.CancelFunc
+	streams  map[uint64]*ServerStream // 正在进行的流式调用
+
+	peer  peer      // 客户端的地址和TLS状态
+	since time.Time // 连接建立的时间
+}
+
+//记录一个正在处理的请求
+func (sc *serverConn) track(seq uint64, cancel context.CancelFunc) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.inflight[seq] = cancel
+}
+
+//请求处理完成
+func (sc *serverConn) untrack(seq uint64) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	delete(sc.inflight, seq)
+}
+
+//客户端放弃了seq对应的请求， 取消服务方法的ctx
+func (sc *serverConn) cancel(seq uint64) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if cancel, ok := sc.inflight[seq]; ok {
+		cancel()
+	}
+}
+
 //进入循环， 对不断传来的消息进行解码处理直到err
-func (server *Server) serveCodec(cc codec.Codec, opt *Option) {
-	sending := new(sync.Mutex) // make sure to send a complete response
-	wg := new(sync.WaitGroup)  // wait until all request are handled
+func (server *Server) serveCodec(cc codec.Codec, opt *Option, p peer) {
+	sc := &serverConn{
+		server:   server,
+		cc:       cc,
+		opt:      opt,
+		inflight: make(map[uint64]context.CancelFunc),
+		streams:  make(map[uint64]*ServerStream),
+		peer:     p,
+		since:    time.Now(),
+	}
+	sc.lim = server.getLimiter()
+	sc.sem = sc.lim.newConnSem()
+	//连接断开时取消所有正在处理的请求
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sc.conn = &Conn{sc: sc, done: ctx.Done()}
+	ctx = context.WithValue(ctx, connKey{}, sc.conn)
+	if !server.trackConn(sc, true) {
+		//服务器正在关闭， 不再接受新的连接
+		_ = cc.Close()
+		return
+	}
+	defer server.trackConn(sc, false)
 	for {
-		req, err := server.readRequest(cc)
+		h, err := server.readRequestHeader(cc)
 		if err != nil {
-			if req == nil {
-				break // it's not possible to recover, so close the connection
-			}
-			req.h.Error = err.Error()
-			server.sendResponse(cc, req.h, invalidRequest, sending)
-			continue
+			break // it's not possible to recover, so close the connection
+		}
+		//读到请求头后立即计为活跃， 优雅关闭不会关闭正在读取请求的连接
+		atomic.AddInt32(&sc.active, 1)
+		atomic.StoreInt64(&sc.lastRead, time.Now().UnixNano())
+		handedOff, err := server.serveRequest(ctx, sc, h)
+		if !handedOff {
+			atomic.AddInt32(&sc.active, -1)
+		}
+		if err != nil {
+			break
 		}
-		wg.Add(1)
-		go server.handleRequest(cc, req, sending, wg, opt.HandleTimeout)
 	}
-	wg.Wait()
+	cancel()
+	//排队的请求不会再获得名额
+	sc.lim.drop(sc.sem)
+	sc.wg.Wait()
 	_ = cc.Close()
 }
 
+//处理一条已经读出消息头的消息， 返回的handedOff表示请求已经交给新的goroutine或者等待队列处理，
+//由它负责减少sc.active； 返回error时连接无法继续使用
+func (server *Server) serveRequest(ctx context.Context, sc *serverConn, h *codec.Header) (handedOff bool, err error) {
+	cc := sc.cc
+	if h.Type == codec.MsgCancel {
+		//取消消息没有消息体
+		if err = cc.ReadBody(nil); err != nil {
+			return false, err
+		}
+		sc.cancel(h.Seq)
+		return false, nil
+	}
+	//已经开启的流上的后续消息
+	if isStreamMessage(h.Type) && h.ServiceMethod == "" {
+		return false, sc.dispatchStream(h)
+	}
+	atomic.AddUint64(&sc.numCalls, 1)
+	req, err := server.readRequest(sc, h)
+	if err == nil && req.mtype.stream != (h.Type == codec.MsgStream) {
+		if req.mtype.stream {
+			err = NewError(CodeInvalidArgument, "rpc server: "+h.ServiceMethod+" is a streaming method")
+		} else {
+			err = NewError(CodeInvalidArgument, "rpc server: "+h.ServiceMethod+" is not a streaming method")
+		}
+	}
+	if err != nil {
+		if h.Type == codec.MsgStream {
+			//流式调用的错误以结束消息返回
+			req.h.Type = codec.MsgStreamEnd
+		}
+		server.countRejected(req, err)
+		setError(req.h, err)
+		req.h.Metadata = nil
+		server.sendResponse(sc, req.h, invalidRequest)
+		return false, nil
+	}
+	//在启动goroutine之前登记cancel， 紧随其后到达的取消消息也能找到这个请求；
+	//排队的请求被取消时同时移出队列
+	//abort在请求被拒绝时释放已经创建的流或ctx， 否则它们会一直挂在连接的ctx上
+	w := &waiter{conn: sc.sem}
+	var abort func()
+	if h.Type == codec.MsgStream {
+		s := sc.openStream(ctx, server, req)
+		ctx = s.ctx
+		w.start = func(err error) { server.handleStream(s, req, err) }
+		sc.track(h.Seq, func() {
+			s.cancel()
+			sc.lim.cancel(w, contextError(s.ctx))
+		})
+		abort = func() {
+			sc.closeStream(s)
+			h.Type = codec.MsgStreamEnd
+		}
+	} else {
+		var cancel context.CancelFunc
+		ctx, cancel = requestContext(ctx, sc.opt, req.h)
+		reqCtx := ctx
+		w.start = func(err error) { server.handleRequest(reqCtx, cancel, sc, req, err) }
+		sc.track(h.Seq, func() {
+			cancel()
+			sc.lim.cancel(w, contextError(reqCtx))
+		})
+		abort = func() {
+			sc.untrack(h.Seq)
+			cancel()
+		}
+	}
+	//没有空闲名额时， 按照策略排队或者直接拒绝
+	sc.wg.Add(1)
+	acquired, err := sc.lim.acquire(ctx, w)
+	if err != nil {
+		sc.wg.Done()
+		abort()
+		server.countRejected(req, err)
+		setError(h, err)
+		h.Metadata = nil
+		server.sendResponse(sc, h, invalidRequest)
+		return false, nil
+	}
+	if acquired {
+		go w.start(nil)
+	}
+	return true, nil
+}
+
 // request stores all information of a call
 type request struct {
 	h            *codec.Header // header of request
@@ -128,100 +388,171 @@ func (server *Server) findService(serviceMethod string) (svc *service, mtype *me
 	//将servicemethod划分为两部分进行处理
 	dot := strings.LastIndex(serviceMethod, ".")
 	if dot < 0 {
-		err = errors.New("rpc server: service/method request ill-formed: " + serviceMethod)
+		err = NewError(CodeInvalidArgument, "rpc server: service/method request ill-formed: "+serviceMethod)
 		return
 	}
 	serviceName, methodName := serviceMethod[:dot], serviceMethod[dot+1:]
 	//返回一个*service
 	svci, ok := server.serviceMap.Load(serviceName)
 	if !ok {
-		err = errors.New("rpc server: can't find service " + serviceName)
+		err = NewError(CodeNotFound, "rpc server: can't find service "+serviceName)
 		return
 	}
 	svc = svci.(*service)
 	mtype = svc.method[methodName]
 	if mtype == nil {
-		err = errors.New("rpc server: can't find method " + methodName)
+		err = NewError(CodeNotFound, "rpc server: can't find method "+methodName)
 	}
 	return
 }
 
-//读请求消息
-func (server *Server) readRequest(cc codec.Codec) (*request, error) {
-	//读请求消息头
-	h, err := server.readRequestHeader(cc)
-	if err != nil {
-		return nil, err
-	}
+//读请求消息 h为已经读出的请求消息头
+func (server *Server) readRequest(sc *serverConn, h *codec.Header) (*request, error) {
+	cc := sc.cc
+	var err error
 	req := &request{h: h}
 	req.svc, req.mtype, err = server.findService(h.ServiceMethod)
+	if err == nil {
+		err = server.authorize(sc, h.ServiceMethod)
+	}
 	if err != nil {
+		//丢弃找不到对应方法或者没有权限的请求的消息体， 保证连接上后续的消息能够被正确解码
+		_ = cc.ReadBody(nil)
 		return req, err
 	}
-	req.argv = req.mtype.newArgv()
-	req.replyv = req.mtype.newReplyv()
+	//流式方法的返回值是ServerStream， 在开启流时创建
+	if !req.mtype.stream {
+		req.replyv = req.mtype.newReplyv()
+	}
+	req.argv, err = readArgv(cc, req.mtype)
+	return req, err
+}
 
+//读取消息体并解码为方法的参数类型
+func readArgv(cc codec.Codec, mtype *methodType) (reflect.Value, error) {
+	argv := mtype.newArgv()
 	// make sure that argvi is a pointer, ReadBody need a pointer as parameter
-	argvi := req.argv.Interface()
-	if req.argv.Type().Kind() != reflect.Ptr {
-		argvi = req.argv.Addr().Interface()
+	argvi := argv.Interface()
+	if argv.Type().Kind() != reflect.Ptr {
+		argvi = argv.Addr().Interface()
 	}
-	if err = cc.ReadBody(argvi); err != nil {
+	if err := cc.ReadBody(argvi); err != nil {
 		log.Println("rpc server: read body err:", err)
-		return req, err
+		return argv, NewError(CodeCodec, err.Error())
 	}
-	return req, nil
+	return argv, nil
 }
 
-//发送返回消息
-func (server *Server) sendResponse(cc codec.Codec, h *codec.Header, body interface{}, sending *sync.Mutex) {
-	sending.Lock()
-	defer sending.Unlock()
-	if err := cc.Write(h, body); err != nil {
+//发送返回消息， one-way请求没有响应， 出错时只记录日志
+func (server *Server) sendResponse(sc *serverConn, h *codec.Header, body interface{}) error {
+	if h.Type == codec.MsgOneWay {
+		if h.Error != "" {
+			log.Printf("rpc server: one-way call %s failed: %s", h.ServiceMethod, h.Error)
+		}
+		return nil
+	}
+	sc.sending.Lock()
+	defer sc.sending.Unlock()
+	if err := sc.cc.Write(h, body); err != nil {
 		log.Println("rpc server: write response error:", err)
+		return err
 	}
+	return nil
+}
+
+//返回处理请求使用的ctx， 客户端的deadline比HandleTimeout更早时以客户端为准
+func requestContext(ctx context.Context, opt *Option, h *codec.Header) (context.Context, context.CancelFunc) {
+	timeout := opt.HandleTimeout
+	if d := time.Duration(h.Timeout); d > 0 && (timeout == 0 || d < timeout) {
+		timeout = d
+	}
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
 }
 
 //处理请求消息并返回结果
-func (server *Server) handleRequest(cc codec.Codec, req *request, sending *sync.Mutex, wg *sync.WaitGroup, timeout time.Duration) {
-	defer wg.Done()
-	called := make(chan struct{})
-	sent := make(chan struct{})
+//服务方法收到的ctx在处理超时、客户端取消请求或者连接断开时被取消， cancel已经由调用方登记在sc中
+//waitErr不为nil表示请求在队列中等待名额时被取消或者超时
+func (server *Server) handleRequest(ctx context.Context, cancel context.CancelFunc, sc *serverConn, req *request, waitErr error) {
+	defer sc.wg.Done()
+	defer atomic.AddInt32(&sc.active, -1)
+	defer cancel()
+	defer sc.untrack(req.h.Seq)
+	//请求元数据通过ctx交给服务方法， 响应头只携带服务方法设置的元数据
+	ctx, replyMD := newIncomingContext(ctx, req.h.Metadata)
+	h := &codec.Header{ServiceMethod: req.h.ServiceMethod, Seq: req.h.Seq, Type: req.h.Type}
+	if waitErr != nil {
+		server.countRejected(req, waitErr)
+		setError(h, waitErr)
+		server.sendResponse(sc, h, invalidRequest)
+		return
+	}
+
+	called := make(chan error, 1)
+	//服务方法单独计为活跃， 超时返回响应之后仍在运行的方法也会阻止优雅关闭时关闭连接
+	atomic.AddInt32(&sc.active, 1)
 	go func() {
-		err := req.svc.call(req.mtype, req.argv, req.replyv)
-		called <- struct{}{}
+		defer atomic.AddInt32(&sc.active, -1)
+		//服务方法返回后才释放名额， 忽略ctx的方法超时后也不会突破上限
+		defer sc.lim.release(sc.sem)
+		called <- server.invoke(ctx, req)
+	}()
+	select {
+	case <-ctx.Done():
+		//服务方法仍在运行， 但已经收到取消信号， 不再等待其返回
+		setError(h, contextError(ctx))
+		server.sendResponse(sc, h, invalidRequest)
+	case err := <-called:
+		h.Metadata = replyMD.get()
 		if err != nil {
-			req.h.Error = err.Error()
-			server.sendResponse(cc, req.h, invalidRequest, sending)
-			sent <- struct{}{}
+			setError(h, err)
+			server.sendResponse(sc, h, invalidRequest)
 			return
 		}
-		server.sendResponse(cc, req.h, req.replyv.Interface(), sending)
-		sent <- struct{}{}
-	}()
-
-	if timeout == 0 {
-		<-called
-		<-sent
-		return
+		//返回值不能被编码时连接仍然可用， 改为发送错误响应， 避免客户端一直等待
+		if err := server.sendResponse(sc, h, req.replyv.Interface()); errors.Is(err, codec.ErrBodyType) {
+			setError(h, NewError(CodeCodec, err.Error()))
+			server.sendResponse(sc, h, invalidRequest)
+		}
 	}
-	select {
-	case <-time.After(timeout):
-		req.h.Error = fmt.Sprintf("rpc server: request handle timeout: expect within %s", timeout)
-		server.sendResponse(cc, req.h, invalidRequest, sending)
-	case <-called:
-		<-sent
+}
+
+//将请求ctx结束的原因转换为返回给客户端的错误
+func contextError(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return ErrDeadlineExceeded
 	}
+	return NewError(CodeCanceled, "rpc server: request canceled: "+ctx.Err().Error())
 }
 
 // Accept accepts connections on the listener and serves requests
 // for each incoming connection.
 // 接受client端连接
 func (server *Server) Accept(lis net.Listener) {
+	//设置了TLS时， 在监听器上完成TLS握手
+	server.mu.Lock()
+	config := server.tlsConfig
+	server.mu.Unlock()
+	if config != nil {
+		lis = tls.NewListener(lis, config)
+	}
+	server.serve(lis)
+}
+
+func (server *Server) serve(lis net.Listener) {
+	if !server.trackListener(lis, true) {
+		_ = lis.Close()
+		return
+	}
+	defer server.trackListener(lis, false)
 	for {
 		conn, err := lis.Accept()
 		if err != nil {
-			log.Println("rpc server: accept error:", err)
+			if !server.shuttingDown() {
+				log.Println("rpc server: accept error:", err)
+			}
 			return
 		}
 		go server.ServeConn(conn)
@@ -236,7 +567,8 @@ func Accept(lis net.Listener) { DefaultServer.Accept(lis) }
 // Register publishes in the server the set of methods of the
 // receiver value that satisfy the following conditions:
 //	- exported method of exported type
-//	- two arguments, both of exported type
+//	- two arguments, both of exported type,
+//	  optionally preceded by a context.Context
 //	- the second argument is a pointer
 //	- one return value, of type error
 
@@ -246,16 +578,21 @@ func Accept(lis net.Listener) { DefaultServer.Accept(lis) }
 //
 //-导出类型的导出方法
 //
-//-两个参数，均为导出类型
+//-两个参数，均为导出类型， 之前可以有一个context.Context参数
 //
 //-第二个参数是指针
 //
 //-一个返回值，类型错误
+//
+//第二个参数为*ServerStream的方法是流式方法， 见ServerStream
 func (server *Server) Register(rcvr interface{}) error {
 	s := newService(rcvr)
 	if _, dup := server.serviceMap.LoadOrStore(s.name, s); dup {
 		return errors.New("rpc: service already defined: " + s.name)
 	}
+	if h := server.getHealth(false); h != nil {
+		h.registered()
+	}
 	return nil
 }
 
@@ -299,7 +636,7 @@ func (server *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 func (server *Server) HandleHTTP() {
 	http.Handle(defaultRPCPath, server)
 	http.Handle(defaultDebugPath, debugHTTP{server})
-	log.Println("rpc server debug path:", defaultDebugPath)
+	log.Println("rpc server debug path:", defaultDebugPath, "(add ?format=json for JSON stats)")
 }
 
 // HandleHTTP is a convenient approach for default server to register HTTP handlers
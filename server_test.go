@@ -0,0 +1,304 @@
+package geerpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"geerpc/codec"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestServer_Shutdown(t *testing.T) {
+	t.Parallel()
+	var b Bar
+	server := NewServer()
+	_ = server.Register(&b)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+
+	call := client.Go("Bar.Timeout", 1, new(int), nil)
+	time.Sleep(time.Millisecond * 100)
+	done := make(chan error, 1)
+	go func() { done <- server.Shutdown(context.Background()) }()
+	time.Sleep(time.Millisecond * 100)
+
+	_assert(!client.IsAvailable(), "expect client to be unavailable after goaway")
+	err := client.Call(context.Background(), "Bar.Timeout", 1, new(int))
+	_assert(err == ErrShutdown, "expect ErrShutdown for new calls, but got %v", err)
+	_, err = Dial("tcp", l.Addr().String())
+	_assert(err != nil, "expect new connections to be refused")
+
+	<-call.Done
+	_assert(call.Error == nil, "in-flight call should complete, but got %v", call.Error)
+	_assert(<-done == nil, "shutdown should complete once in-flight calls are done")
+}
+
+func TestServer_ShutdownTimeout(t *testing.T) {
+	t.Parallel()
+	var b Bar
+	server := NewServer()
+	_ = server.Register(&b)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+
+	call := client.Go("Bar.Timeout", 1, new(int), nil)
+	time.Sleep(time.Millisecond * 100)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	err := server.Shutdown(ctx)
+	_assert(err == context.DeadlineExceeded, "expect shutdown to time out, but got %v", err)
+	_ = server.Close()
+	<-call.Done
+	_assert(call.Error != nil, "expect the call to fail after Close")
+}
+
+func TestServer_ShutdownGracePeriod(t *testing.T) {
+	t.Parallel()
+	var foo Foo
+	server := NewServer()
+	_ = server.Register(&foo)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+
+	// a request sent before the client sees the goaway is still served
+	conn, _ := net.Dial("tcp", l.Addr().String())
+	_ = json.NewEncoder(conn).Encode(DefaultOption)
+	cc := codec.NewGobCodec(conn)
+	defer func() { _ = cc.Close() }()
+	var h codec.Header
+	var reply int
+	sum := func(seq uint64) {
+		_ = cc.Write(&codec.Header{ServiceMethod: "Foo.Sum", Seq: seq}, Args{Num1: 1, Num2: 2})
+		_assert(cc.ReadHeader(&h) == nil && h.Seq == seq && h.Error == "", "expect the response, got %+v", h)
+		_assert(cc.ReadBody(&reply) == nil && reply == 3, "expect 3, got %d", reply)
+	}
+	sum(1)
+	done := make(chan error, 1)
+	go func() { done <- server.Shutdown(context.Background()) }()
+	_assert(cc.ReadHeader(&h) == nil && h.Type == codec.MsgGoAway, "expect a goaway, got %+v", h)
+	_ = cc.ReadBody(nil)
+	sum(2)
+	_assert(<-done == nil, "shutdown should complete after the grace period")
+}
+
+func TestServer_ShutdownWaitsForMethods(t *testing.T) {
+	t.Parallel()
+	var b Bar
+	server := NewServer()
+	_ = server.Register(&b)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	client, _ := Dial("tcp", l.Addr().String(), &Option{HandleTimeout: 100 * time.Millisecond})
+	defer func() { _ = client.Close() }()
+
+	start := time.Now()
+	err := client.Call(context.Background(), "Bar.Timeout", 1, new(int))
+	_assert(err == ErrDeadlineExceeded, "expect ErrDeadlineExceeded, got %v", err)
+	// Bar.Timeout ignores ctx and is still running after the response was sent
+	_assert(server.Shutdown(context.Background()) == nil, "expect shutdown to complete")
+	_assert(time.Since(start) >= 2*time.Second, "shutdown returned while the method was still running")
+}
+
+func TestServer_Use(t *testing.T) {
+	t.Parallel()
+	var foo Foo
+	server := NewServer()
+	_ = server.Register(&foo)
+	var trace []string
+	server.Use(func(ctx context.Context, info *ServerInfo, argv, replyv interface{}, next Handler) error {
+		trace = append(trace, "outer:"+info.ServiceMethod)
+		err := next(ctx, argv, replyv)
+		trace = append(trace, "outer done")
+		return err
+	}, func(ctx context.Context, info *ServerInfo, argv, replyv interface{}, next Handler) error {
+		md, _ := FromIncomingContext(ctx)
+		if md["token"] != "secret" {
+			return errors.New("unauthenticated")
+		}
+		// arguments can be rewritten before reaching the method
+		args := argv.(Args)
+		args.Num2 *= 10
+		return next(ctx, args, replyv)
+	})
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	err := client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err != nil && err.Error() == "unauthenticated", "expect the call to be rejected, but got %v", err)
+	ctx := NewOutgoingContext(context.Background(), Metadata{"token": "secret"})
+	err = client.Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 21, "expect 21, but got %d, %v", reply, err)
+	_assert(len(trace) == 4 && trace[0] == "outer:Foo.Sum" && trace[3] == "outer done", "unexpected trace %v", trace)
+}
+
+func TestServer_UseMisbehaving(t *testing.T) {
+	t.Parallel()
+	var foo Foo
+	server := NewServer()
+	_ = server.Register(&foo)
+	server.Use(func(ctx context.Context, info *ServerInfo, argv, replyv interface{}, next Handler) error {
+		md, _ := FromIncomingContext(ctx)
+		switch md["mode"] {
+		case "wrong arg":
+			return next(ctx, "not args", replyv)
+		case "wrong reply":
+			return next(ctx, argv, new(string))
+		case "replaced reply":
+			return next(ctx, argv, new(int))
+		case "nil reply":
+			return next(ctx, argv, nil)
+		case "panic":
+			panic("interceptor failed")
+		}
+		return next(ctx, argv, replyv)
+	})
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+
+	for _, mode := range []string{"wrong arg", "wrong reply", "replaced reply", "nil reply", "panic"} {
+		var reply int
+		ctx := NewOutgoingContext(context.Background(), Metadata{"mode": mode})
+		err := client.Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+		_assert(ErrorCode(err) == CodeInternal, "%s: expect an internal error, but got %v", mode, err)
+	}
+	var reply int
+	err := client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "expect the server to keep working, but got %d, %v", reply, err)
+}
+
+type Gate struct{ open chan struct{} }
+
+func (g *Gate) Pass(n int, reply *int) error {
+	<-g.open
+	*reply = n
+	return nil
+}
+
+func TestServer_SetLimits(t *testing.T) {
+	t.Parallel()
+	start := func(l Limits) (*Gate, *Client) {
+		gate := &Gate{open: make(chan struct{})}
+		server := NewServer()
+		_ = server.Register(gate)
+		server.SetLimits(l)
+		lis, _ := net.Listen("tcp", ":0")
+		go server.Accept(lis)
+		client, _ := Dial("tcp", lis.Addr().String())
+		return gate, client
+	}
+	t.Run("reject", func(t *testing.T) {
+		gate, client := start(Limits{MaxInFlight: 1})
+		defer func() { _ = client.Close() }()
+		first := client.Go("Gate.Pass", 1, new(int), nil)
+		time.Sleep(time.Millisecond * 100)
+		err := client.Call(context.Background(), "Gate.Pass", 2, new(int))
+		_assert(err == ErrServerBusy, "expect ErrServerBusy, but got %v", err)
+		close(gate.open)
+		_assert((<-first.Done).Error == nil, "expect the first call to succeed")
+	})
+	t.Run("queue", func(t *testing.T) {
+		gate, client := start(Limits{MaxConnInFlight: 1, Policy: QueueWhenBusy, QueueSize: 1})
+		defer func() { _ = client.Close() }()
+		first := client.Go("Gate.Pass", 1, new(int), nil)
+		time.Sleep(time.Millisecond * 100)
+		var reply int
+		second := client.Go("Gate.Pass", 2, &reply, nil)
+		time.Sleep(time.Millisecond * 100)
+		err := client.Call(context.Background(), "Gate.Pass", 3, new(int))
+		_assert(err == ErrServerBusy, "expect ErrServerBusy when the queue is full, but got %v", err)
+		close(gate.open)
+		_assert((<-first.Done).Error == nil, "expect the first call to succeed")
+		_assert((<-second.Done).Error == nil && reply == 2, "expect the queued call to succeed")
+	})
+	t.Run("queued requests don't hold goroutines", func(t *testing.T) {
+		gate, client := start(Limits{MaxInFlight: 1, Policy: QueueWhenBusy, QueueSize: 200})
+		defer func() { _ = client.Close() }()
+		first := client.Go("Gate.Pass", 0, new(int), nil)
+		time.Sleep(time.Millisecond * 100)
+		before := runtime.NumGoroutine()
+		calls := make([]*Call, 200)
+		for i := range calls {
+			calls[i] = client.Go("Gate.Pass", i+1, new(int), nil)
+		}
+		time.Sleep(time.Millisecond * 200)
+		_assert(runtime.NumGoroutine()-before < 50, "expect queued requests to wait without goroutines, %d -> %d",
+			before, runtime.NumGoroutine())
+		err := client.Call(context.Background(), "Gate.Pass", 0, new(int))
+		_assert(err == ErrServerBusy, "expect ErrServerBusy when the queue is full, but got %v", err)
+		close(gate.open)
+		_assert((<-first.Done).Error == nil, "expect the first call to succeed")
+		for i, call := range calls {
+			<-call.Done
+			_assert(call.Error == nil && *call.Reply.(*int) == i+1, "expect queued call %d to succeed: %v", i, call.Error)
+		}
+	})
+	t.Run("queued requests time out or get canceled", func(t *testing.T) {
+		gate, client := start(Limits{MaxInFlight: 1, Policy: QueueWhenBusy, QueueSize: 1})
+		defer func() { _ = client.Close() }()
+		first := client.Go("Gate.Pass", 1, new(int), nil)
+		time.Sleep(time.Millisecond * 100)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+		defer cancel()
+		err := client.Call(ctx, "Gate.Pass", 2, new(int))
+		_assert(ErrorCode(err) == CodeDeadlineExceeded, "expect the queued call to time out, but got %v", err)
+		// the expired request leaves the queue, so there is room for another one
+		time.Sleep(time.Millisecond * 50)
+		ctx, cancel = context.WithCancel(context.Background())
+		time.AfterFunc(time.Millisecond*100, cancel)
+		err = client.Call(ctx, "Gate.Pass", 3, new(int))
+		_assert(ErrorCode(err) == CodeCanceled, "expect the queued call to be canceled, but got %v", err)
+		var reply int
+		second := client.Go("Gate.Pass", 4, &reply, nil)
+		close(gate.open)
+		_assert((<-first.Done).Error == nil, "expect the first call to succeed")
+		_assert((<-second.Done).Error == nil && reply == 4, "expect the queued call to succeed")
+	})
+}
+
+// 不并行执行， 避免其他测试的内存分配影响统计
+func TestServer_SetLimitsRejectedMemory(t *testing.T) {
+	gate := &Gate{open: make(chan struct{})}
+	server := NewServer()
+	_ = server.Register(gate)
+	server.SetLimits(Limits{MaxInFlight: 1})
+	lis, _ := net.Listen("tcp", ":0")
+	go server.Accept(lis)
+	client, _ := Dial("tcp", lis.Addr().String(), &Option{HandleTimeout: time.Hour})
+	defer func() { _ = client.Close() }()
+	first := client.Go("Gate.Pass", 0, new(int), nil)
+	time.Sleep(time.Millisecond * 100)
+
+	reject := func(n int) {
+		for i := 0; i < n; i++ {
+			err := client.Call(context.Background(), "Gate.Pass", i, new(int))
+			_assert(err == ErrServerBusy, "expect ErrServerBusy, but got %v", err)
+		}
+	}
+	heap := func() uint64 {
+		runtime.GC()
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		return m.HeapAlloc
+	}
+	reject(1000)
+	before := heap()
+	const n = 20000
+	reject(n)
+	after := heap()
+	// the rejected requests must not stay referenced by the connection
+	_assert(after < before+n*16, "expect the heap to stay flat, %d -> %d bytes after %d rejected calls", before, after, n)
+	close(gate.open)
+	_assert((<-first.Done).Error == nil, "expect the first call to succeed")
+}
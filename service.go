@@ -1,25 +1,64 @@
 package geerpc
 
 import (
+	"context"
 	"go/ast"
 	"log"
 	"reflect"
+	"runtime"
 	"sync/atomic"
+	"time"
 )
 
 //方法类型类
+//原子操作的64位计数器放在最前面， 保证在32位平台上8字节对齐
 type methodType struct {
+	numCalls  uint64         //调用次数
+	numPanics uint64         //方法panic的次数
+	numErrors uint64         //方法返回error的次数， 包括panic
+	inFlight  int64          //正在执行的调用数
+	latency   histogram      //方法执行耗时
 	method    reflect.Method //方法本身
 	ArgType   reflect.Type   //第一个参数类型
 	ReplyType reflect.Type   //第二个参数类型
-	numCalls  uint64         //调用次数
+	withCtx   bool           //方法的第一个参数是否为context.Context
+	stream    bool           //是否为流式方法， 即第二个参数为*ServerStream
 }
 
+var (
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
 //原子方法返回numCalls
 func (m *methodType) NumCalls() uint64 {
 	return atomic.LoadUint64(&m.numCalls)
 }
 
+//原子方法返回numPanics
+func (m *methodType) NumPanics() uint64 {
+	return atomic.LoadUint64(&m.numPanics)
+}
+
+//原子方法返回numErrors
+func (m *methodType) NumErrors() uint64 {
+	return atomic.LoadUint64(&m.numErrors)
+}
+
+//原子方法返回inFlight
+func (m *methodType) InFlight() int64 {
+	return atomic.LoadInt64(&m.inFlight)
+}
+
+//已完成调用的平均耗时
+func (m *methodType) AvgLatency() time.Duration {
+	count := atomic.LoadUint64(&m.latency.count)
+	if count == 0 {
+		return 0
+	}
+	return time.Duration(atomic.LoadUint64(&m.latency.sum) / count)
+}
+
 //创建一个argv实例
 func (m *methodType) newArgv() reflect.Value {
 	var argv reflect.Value
@@ -73,13 +112,15 @@ func (s *service) registerMethods() {
 	for i := 0; i < s.typ.NumMethod(); i++ {
 		method := s.typ.Method(i)
 		mType := method.Type
-		if mType.NumIn() != 3 || mType.NumOut() != 1 {
+		if mType.NumOut() != 1 || mType.Out(0) != typeOfError {
 			continue
 		}
-		if mType.Out(0) != reflect.TypeOf((*error)(nil)).Elem() {
+		// func(args, *reply) error 或 func(ctx, args, *reply) error
+		withCtx := mType.NumIn() == 4 && mType.In(1) == typeOfContext
+		if mType.NumIn() != 3 && !withCtx {
 			continue
 		}
-		argType, replyType := mType.In(1), mType.In(2)
+		argType, replyType := mType.In(mType.NumIn()-2), mType.In(mType.NumIn()-1)
 		if !isExportedOrBuiltinType(argType) || !isExportedOrBuiltinType(replyType) {
 			continue
 		}
@@ -87,22 +128,82 @@ func (s *service) registerMethods() {
 			method:    method,
 			ArgType:   argType,
 			ReplyType: replyType,
+			withCtx:   withCtx,
+			stream:    replyType == typeOfServerStream,
 		}
 		log.Printf("rpc server: register %s.%s\n", s.name, method.Name)
 	}
 }
 
 //通过reflect.value.Call([]reflect.value 实现对于service.method的调用
-func (s *service) call(m *methodType, argv, replyv reflect.Value) error {
+//方法panic时恢复并返回error， 不影响服务器进程和连接
+//同时统计调用次数、错误次数和耗时
+func (s *service) call(ctx context.Context, m *methodType, argv, replyv reflect.Value) error {
+	return s.guard(m, func() error { return s.callMethod(ctx, m, argv, replyv) })
+}
+
+//执行fn， fn中的服务方法或者拦截器panic时恢复并返回error， 同时统计调用次数、错误次数和耗时
+func (s *service) guard(m *methodType, fn func() error) (err error) {
 	atomic.AddUint64(&m.numCalls, 1)
+	atomic.AddInt64(&m.inFlight, 1)
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddUint64(&m.numPanics, 1)
+			buf := make([]byte, 64<<10)
+			buf = buf[:runtime.Stack(buf, false)]
+			log.Printf("rpc server: panic in %s.%s: %v\n%s", s.name, m.method.Name, r, buf)
+			err = Errorf(CodeInternal, "rpc server: %s.%s panic: %v", s.name, m.method.Name, r)
+		}
+		if err != nil {
+			atomic.AddUint64(&m.numErrors, 1)
+		}
+		m.latency.observe(time.Since(start))
+		atomic.AddInt64(&m.inFlight, -1)
+	}()
+	return fn()
+}
+
+//方法接受context.Context时将ctx作为第一个参数传入
+func (s *service) callMethod(ctx context.Context, m *methodType, argv, replyv reflect.Value) error {
 	f := m.method.Func
-	returnValues := f.Call([]reflect.Value{s.rcvr, argv, replyv})
+	in := []reflect.Value{s.rcvr, argv, replyv}
+	if m.withCtx {
+		in = []reflect.Value{s.rcvr, reflect.ValueOf(ctx), argv, replyv}
+	}
+	returnValues := f.Call(in)
 	if errInter := returnValues[0].Interface(); errInter != nil {
 		return errInter.(error)
 	}
 	return nil
 }
 
+//检查拦截器传给服务方法的参数和返回值是否为方法声明的类型， nil只能用于可以为nil的类型
+func (s *service) checkArgs(m *methodType, argv, replyv interface{}) (reflect.Value, reflect.Value, error) {
+	av, err := s.checkValue(m, "argument", argv, m.ArgType)
+	if err != nil {
+		return av, av, err
+	}
+	rv, err := s.checkValue(m, "reply", replyv, m.ReplyType)
+	if err == nil && rv.IsNil() {
+		err = Errorf(CodeInternal, "rpc server: nil reply passed to %s.%s", s.name, m.method.Name)
+	}
+	return av, rv, err
+}
+
+func (s *service) checkValue(m *methodType, what string, v interface{}, t reflect.Type) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			return reflect.Zero(t), nil
+		}
+	} else if rv.Type().AssignableTo(t) {
+		return rv, nil
+	}
+	return rv, Errorf(CodeInternal, "rpc server: wrong %s type %T passed to %s.%s, expect %s", what, v, s.name, m.method.Name, t)
+}
+
 func isExportedOrBuiltinType(t reflect.Type) bool {
 	return ast.IsExported(t.Name()) || t.PkgPath() == ""
 }
@@ -1,8 +1,10 @@
 package geerpc
 
 import (
+	"context"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -43,6 +45,26 @@ func TestMethodType_Call(t *testing.T) {
 	argv := mType.newArgv()
 	replyv := mType.newReplyv()
 	argv.Set(reflect.ValueOf(Args{Num1: 1, Num2: 3}))
-	err := s.call(mType, argv, replyv)
+	err := s.call(context.Background(), mType, argv, replyv)
 	_assert(err == nil && *replyv.Interface().(*int) == 4 && mType.NumCalls() == 1, "failed to call Foo.Sum")
 }
+
+type Crash int
+
+func (c Crash) Div(args Args, reply *int) error {
+	*reply = args.Num1 / args.Num2
+	return nil
+}
+
+func TestMethodType_CallPanic(t *testing.T) {
+	var crash Crash
+	s := newService(&crash)
+	mType := s.method["Div"]
+
+	argv := mType.newArgv()
+	replyv := mType.newReplyv()
+	argv.Set(reflect.ValueOf(Args{Num1: 1, Num2: 0}))
+	err := s.call(context.Background(), mType, argv, replyv)
+	_assert(err != nil && strings.Contains(err.Error(), "Crash.Div panic"), "expect a panic error, but got %v", err)
+	_assert(mType.NumCalls() == 1 && mType.NumPanics() == 1, "expect the panic to be counted")
+}
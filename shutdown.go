@@ -0,0 +1,134 @@
+package geerpc
+
+import (
+	"context"
+	"geerpc/codec"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// 优雅关闭时检查连接是否空闲的间隔
+	shutdownPollInterval = 10 * time.Millisecond
+	// 发送GoAway之后， 连接至少要空闲这么久才会被关闭，
+	// 让客户端收到GoAway之前已经发出的请求有机会到达服务器
+	shutdownGracePeriod = 100 * time.Millisecond
+)
+
+// 记录或移除一个正在监听的listener， 服务器关闭后返回false
+func (server *Server) trackListener(lis net.Listener, add bool) bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.listeners == nil {
+		server.listeners = make(map[net.Listener]struct{})
+	}
+	if add {
+		if server.inShutdown {
+			return false
+		}
+		server.listeners[lis] = struct{}{}
+	} else {
+		delete(server.listeners, lis)
+	}
+	return true
+}
+
+// 记录或移除一个连接， 服务器关闭后返回false
+func (server *Server) trackConn(sc *serverConn, add bool) bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.conns == nil {
+		server.conns = make(map[*serverConn]struct{})
+	}
+	if add {
+		if server.inShutdown {
+			return false
+		}
+		server.conns[sc] = struct{}{}
+	} else {
+		delete(server.conns, sc)
+	}
+	return true
+}
+
+func (server *Server) shuttingDown() bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return server.inShutdown
+}
+
+// 停止接受新连接， 返回当前所有的连接
+func (server *Server) stopAccepting() []*serverConn {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.inShutdown = true
+	for lis := range server.listeners {
+		_ = lis.Close()
+		delete(server.listeners, lis)
+	}
+	conns := make([]*serverConn, 0, len(server.conns))
+	for sc := range server.conns {
+		conns = append(conns, sc)
+	}
+	return conns
+}
+
+// 关闭所有空闲的连接， 返回是否所有连接都已关闭。
+// 连接空闲是指没有正在处理的请求和运行中的服务方法， 并且在goAway之后的宽限期内没有读到新的请求
+func (server *Server) closeIdleConns(goAway time.Time) bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	for sc := range server.conns {
+		last := time.Unix(0, atomic.LoadInt64(&sc.lastRead))
+		if last.Before(goAway) {
+			last = goAway
+		}
+		if atomic.LoadInt32(&sc.active) == 0 && time.Since(last) >= shutdownGracePeriod {
+			_ = sc.cc.Close()
+			delete(server.conns, sc)
+		}
+	}
+	return len(server.conns) == 0
+}
+
+// Shutdown 优雅地关闭服务器：
+// 首先关闭所有listener， 健康检查服务的状态变为StatusNotServing， 然后通知所有已连接的客户端不要再发送新的请求，
+// 等待正在处理的请求和服务方法完成， 并且连接在一段宽限期内没有新的请求到达后关闭连接。
+// ctx结束时仍有请求没有完成则返回ctx.Err()， 此时可以调用Close强制关闭。
+func (server *Server) Shutdown(ctx context.Context) error {
+	if h := server.getHealth(false); h != nil {
+		h.shutdown()
+	}
+	for _, sc := range server.stopAccepting() {
+		server.sendResponse(sc, &codec.Header{Type: codec.MsgGoAway}, invalidRequest)
+	}
+	goAway := time.Now()
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if server.closeIdleConns(goAway) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close 立即关闭所有listener和连接， 正在处理的请求的ctx会被取消
+func (server *Server) Close() error {
+	if h := server.getHealth(false); h != nil {
+		h.shutdown()
+	}
+	server.stopAccepting()
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	for sc := range server.conns {
+		_ = sc.cc.Close()
+		delete(server.conns, sc)
+	}
+	return nil
+}
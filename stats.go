@@ -0,0 +1,162 @@
+package geerpc
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets 是处理耗时直方图各个桶的上界， 最后还有一个不限上界的桶
+var latencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// histogram 是并发安全的耗时直方图
+type histogram struct {
+	buckets [12]uint64 // len(latencyBuckets)+1
+	count   uint64
+	sum     uint64 // 纳秒
+	max     uint64 // 纳秒
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := sort.Search(len(latencyBuckets), func(i int) bool { return d <= latencyBuckets[i] })
+	atomic.AddUint64(&h.buckets[i], 1)
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddUint64(&h.sum, uint64(d))
+	for {
+		max := atomic.LoadUint64(&h.max)
+		if uint64(d) <= max || atomic.CompareAndSwapUint64(&h.max, max, uint64(d)) {
+			return
+		}
+	}
+}
+
+// quantile 返回q分位耗时的估计值， 即累计数量达到q的桶的上界， 落在最后一个桶时返回最大耗时
+func (h *histogram) quantile(q float64) time.Duration {
+	count := atomic.LoadUint64(&h.count)
+	if count == 0 {
+		return 0
+	}
+	rank := uint64(q*float64(count) + 0.5)
+	if rank == 0 {
+		rank = 1
+	}
+	var cumulative uint64
+	for i, bound := range latencyBuckets {
+		cumulative += atomic.LoadUint64(&h.buckets[i])
+		if cumulative >= rank {
+			return bound
+		}
+	}
+	return time.Duration(atomic.LoadUint64(&h.max))
+}
+
+// Stats 是服务器的运行统计， 由Server.Stats返回， 调试页面以JSON格式输出
+type Stats struct {
+	Services    []ServiceStats `json:"services"`
+	Connections []ConnStats    `json:"connections"`
+}
+
+// ServiceStats 是一个服务的统计
+type ServiceStats struct {
+	Name    string        `json:"name"`
+	Methods []MethodStats `json:"methods"`
+}
+
+// MethodStats 是一个方法的统计， 耗时以纳秒为单位， 分位数是按直方图估计的值
+type MethodStats struct {
+	Name           string        `json:"name"`
+	ArgType        string        `json:"arg_type"`
+	ReplyType      string        `json:"reply_type"`
+	Calls          uint64        `json:"calls"`
+	Errors         uint64        `json:"errors"`
+	Panics         uint64        `json:"panics"`
+	InFlight       int64         `json:"in_flight"`
+	TotalLatency   time.Duration `json:"total_latency_ns"`
+	AvgLatency     time.Duration `json:"avg_latency_ns"`
+	P50Latency     time.Duration `json:"p50_latency_ns"`
+	P90Latency     time.Duration `json:"p90_latency_ns"`
+	P99Latency     time.Duration `json:"p99_latency_ns"`
+	LatencyBuckets []uint64      `json:"latency_buckets"` // 各个桶的数量， 与LatencyBounds对应， 最后一个桶不限上界
+	LatencyBounds  []int64       `json:"latency_bounds_ns"`
+}
+
+// ConnStats 是一个连接的统计
+type ConnStats struct {
+	Remote   string    `json:"remote"`
+	Since    time.Time `json:"since"`
+	Calls    uint64    `json:"calls"`
+	InFlight int32     `json:"in_flight"` // 正在处理和排队的请求数， 包括流式调用
+}
+
+func (m *methodType) stats(name string) MethodStats {
+	s := MethodStats{
+		Name:         name,
+		ArgType:      m.ArgType.String(),
+		ReplyType:    m.ReplyType.String(),
+		Calls:        m.NumCalls(),
+		Errors:       m.NumErrors(),
+		Panics:       m.NumPanics(),
+		InFlight:     m.InFlight(),
+		TotalLatency: time.Duration(atomic.LoadUint64(&m.latency.sum)),
+		AvgLatency:   m.AvgLatency(),
+		P50Latency:   m.latency.quantile(0.5),
+		P90Latency:   m.latency.quantile(0.9),
+		P99Latency:   m.latency.quantile(0.99),
+	}
+	for i := range m.latency.buckets {
+		s.LatencyBuckets = append(s.LatencyBuckets, atomic.LoadUint64(&m.latency.buckets[i]))
+	}
+	for _, bound := range latencyBuckets {
+		s.LatencyBounds = append(s.LatencyBounds, int64(bound))
+	}
+	return s
+}
+
+// Stats 返回所有服务和连接的统计， 服务和方法按名称排序
+func (server *Server) Stats() *Stats {
+	stats := &Stats{Services: []ServiceStats{}, Connections: []ConnStats{}}
+	server.serviceMap.Range(func(namei, svci interface{}) bool {
+		svc := svci.(*service)
+		ss := ServiceStats{Name: namei.(string)}
+		for name, m := range svc.method {
+			ss.Methods = append(ss.Methods, m.stats(name))
+		}
+		sort.Slice(ss.Methods, func(i, j int) bool { return ss.Methods[i].Name < ss.Methods[j].Name })
+		stats.Services = append(stats.Services, ss)
+		return true
+	})
+	sort.Slice(stats.Services, func(i, j int) bool { return stats.Services[i].Name < stats.Services[j].Name })
+
+	server.mu.Lock()
+	conns := make([]*serverConn, 0, len(server.conns))
+	for sc := range server.conns {
+		conns = append(conns, sc)
+	}
+	server.mu.Unlock()
+	for _, sc := range conns {
+		//sc.active还包括正在读取的请求和超时后仍在运行的方法， 不能作为请求数
+		sc.mu.Lock()
+		inFlight := len(sc.inflight)
+		sc.mu.Unlock()
+		stats.Connections = append(stats.Connections, ConnStats{
+			Remote:   sc.peer.remote,
+			Since:    sc.since,
+			Calls:    atomic.LoadUint64(&sc.numCalls),
+			InFlight: int32(inFlight),
+		})
+	}
+	sort.Slice(stats.Connections, func(i, j int) bool { return stats.Connections[i].Since.Before(stats.Connections[j].Since) })
+	return stats
+}
@@ -0,0 +1,72 @@
+package geerpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHistogram_Quantile(t *testing.T) {
+	var h histogram
+	_assert(h.quantile(0.5) == 0, "expect 0 for an empty histogram")
+	for i := 0; i < 90; i++ {
+		h.observe(time.Millisecond)
+	}
+	for i := 0; i < 9; i++ {
+		h.observe(50 * time.Millisecond)
+	}
+	h.observe(time.Minute)
+	_assert(h.quantile(0.5) == time.Millisecond, "wrong p50 %s", h.quantile(0.5))
+	_assert(h.quantile(0.9) == time.Millisecond, "wrong p90 %s", h.quantile(0.9))
+	_assert(h.quantile(0.99) == 50*time.Millisecond, "wrong p99 %s", h.quantile(0.99))
+	_assert(h.quantile(1) == time.Minute, "expect the max for the last bucket, got %s", h.quantile(1))
+}
+
+func TestServer_Stats(t *testing.T) {
+	t.Parallel()
+	server := NewServer()
+	_ = server.Register(&Flaky{})
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+	for i := 0; i < 4; i++ {
+		var reply string
+		_ = client.Call(context.Background(), "Flaky.Hello", "gee", &reply)
+	}
+
+	w := httptest.NewRecorder()
+	debugHTTP{server}.ServeHTTP(w, httptest.NewRequest("GET", defaultDebugPath+"?format=json", nil))
+	_assert(w.Header().Get("Content-Type") == "application/json", "expect JSON content")
+	var stats Stats
+	_assert(json.Unmarshal(w.Body.Bytes(), &stats) == nil, "failed to decode stats: %s", w.Body.String())
+	_assert(len(stats.Services) == 2 && stats.Services[0].Name == "Flaky" && stats.Services[1].Name == HealthService, "expect services sorted by name")
+	hello := stats.Services[0].Methods[0]
+	_assert(hello.Name == "Hello" && hello.Calls == 4 && hello.Errors == 2 && hello.InFlight == 0,
+		"wrong method stats %+v", hello)
+	_assert(hello.TotalLatency > 0 && hello.AvgLatency == hello.TotalLatency/4, "wrong latency %+v", hello)
+	_assert(hello.P50Latency > 0 && hello.P50Latency <= hello.P99Latency, "wrong percentiles %+v", hello)
+	_assert(len(hello.LatencyBuckets) == len(latencyBuckets)+1, "expect every bucket")
+	_assert(len(stats.Connections) == 1 && stats.Connections[0].Calls == 4 && stats.Connections[0].InFlight == 0,
+		"wrong connection stats %+v", stats.Connections)
+
+	// a running call counts once for both the method and the connection
+	gate := &Gate{open: make(chan struct{})}
+	_ = server.Register(gate)
+	call := client.Go("Gate.Pass", 1, new(int), nil)
+	for i := 0; i < 100 && server.Stats().Services[1].Methods[0].InFlight == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	running := server.Stats()
+	_assert(running.Services[1].Methods[0].InFlight == 1 && running.Connections[0].InFlight == 1,
+		"expect one call in flight, got method %+v, connection %+v", running.Services[1].Methods[0], running.Connections[0])
+	close(gate.open)
+	<-call.Done
+
+	w = httptest.NewRecorder()
+	debugHTTP{server}.ServeHTTP(w, httptest.NewRequest("GET", defaultDebugPath, nil))
+	_assert(w.Code == 200 && w.Header().Get("Content-Type") != "application/json", "expect the HTML page by default")
+}
@@ -0,0 +1,475 @@
+package geerpc
+
+import (
+	"context"
+	"geerpc/codec"
+	"io"
+	"log"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 流式调用在同一个Seq上传输多条消息：
+//
+//   - 客户端发送的第一条MsgStream消息携带ServiceMethod和参数， 服务端收到后开始执行流式方法
+//   - 双方都可以继续发送MsgStream消息， 客户端发送MsgStreamEnd表示不再发送
+//   - 服务端方法返回后发送MsgStreamEnd结束整个流， Error不为空时表示方法返回了错误
+//   - 客户端发送MsgCancel取消流
+//
+// 流量控制以消息条数计算： 每个方向初始有streamWindow个发送额度， 每发送一条消息消耗一个，
+// 接收方每消费streamWindowUpdate条消息就发送一条MsgWindowUpdate， 为对方增加streamWindowUpdate个额度
+const (
+	streamWindow       = 32
+	streamWindowUpdate = streamWindow / 2
+)
+
+var (
+	typeOfServerStream = reflect.TypeOf((*ServerStream)(nil))
+
+	errStreamOverflow error = NewError(CodeInvalidArgument, "rpc: stream flow control violated")
+	errStreamClosed   error = NewError(CodeInvalidArgument, "rpc: stream is closed")
+)
+
+// window 是一个方向上的发送额度
+type window struct {
+	mu     sync.Mutex
+	n      int
+	notify chan struct{}
+}
+
+func newWindow() *window {
+	return &window{n: streamWindow, notify: make(chan struct{}, 1)}
+}
+
+// take 消耗一个发送额度， 没有额度时等待对方的MsgWindowUpdate
+func (w *window) take(ctx context.Context, done <-chan struct{}) error {
+	for {
+		w.mu.Lock()
+		if w.n > 0 {
+			w.n--
+			w.mu.Unlock()
+			return nil
+		}
+		w.mu.Unlock()
+		select {
+		case <-w.notify:
+		case <-done:
+			return errStreamClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (w *window) add(n int) {
+	w.mu.Lock()
+	w.n += n
+	w.mu.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// recvQueue 缓存已经解码、尚未被读取的消息， 容量即接收窗口大小
+type recvQueue struct {
+	ch       chan reflect.Value
+	once     sync.Once
+	done     chan struct{} // 对方不再发送消息时关闭
+	err      error         // done关闭的原因， nil表示正常结束
+	consumed int           // 自上次发送MsgWindowUpdate以来消费的消息数
+}
+
+func newRecvQueue() *recvQueue {
+	return &recvQueue{ch: make(chan reflect.Value, streamWindow), done: make(chan struct{})}
+}
+
+// push 由读取连接的goroutine调用， 对方超出发送额度时返回false
+func (q *recvQueue) push(v reflect.Value) bool {
+	select {
+	case q.ch <- v:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *recvQueue) finish(err error) {
+	q.once.Do(func() {
+		q.err = err
+		close(q.done)
+	})
+}
+
+// pop 取出下一条消息， 对方正常结束时返回io.EOF
+// 返回的update表示需要为对方增加发送额度
+func (q *recvQueue) pop(ctx context.Context) (v reflect.Value, update bool, err error) {
+	select {
+	case v = <-q.ch:
+	default:
+		select {
+		case v = <-q.ch:
+		case <-q.done:
+			// done之前到达的消息仍然需要读完
+			select {
+			case v = <-q.ch:
+			default:
+				if q.err != nil {
+					return v, false, q.err
+				}
+				return v, false, io.EOF
+			}
+		case <-ctx.Done():
+			return v, false, ctx.Err()
+		}
+	}
+	q.consumed++
+	if q.consumed == streamWindowUpdate {
+		q.consumed = 0
+		update = true
+	}
+	return v, update, nil
+}
+
+func isStreamMessage(t codec.MessageType) bool {
+	return t == codec.MsgStream || t == codec.MsgStreamEnd || t == codec.MsgWindowUpdate
+}
+
+// 将接收到的消息赋值给调用方传入的指针
+func assignTo(dst interface{}, v reflect.Value) error {
+	dv := reflect.ValueOf(dst)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return NewError(CodeInvalidArgument, "rpc: stream receive target must be a non-nil pointer")
+	}
+	if v.Kind() == reflect.Ptr && v.Type() != dv.Elem().Type() {
+		v = v.Elem()
+	}
+	if !v.Type().AssignableTo(dv.Elem().Type()) {
+		return NewError(CodeInvalidArgument, "rpc: can't receive "+v.Type().String()+" into "+dv.Type().String())
+	}
+	dv.Elem().Set(v)
+	return nil
+}
+
+// ServerStream 是流式方法与客户端之间的流， 流式方法的签名为
+//
+//	func (t *T) MethodName(args T1, stream *ServerStream) error
+//
+// args是客户端发送的第一条消息， 之后客户端发送的消息也都是T1类型， 通过Recv读取；
+// 通过Send向客户端发送任意条消息， 方法返回即结束这个流。
+// 服务端流式、客户端流式和双向流式调用都使用这一种签名。
+type ServerStream struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	server *Server
+	sc     *serverConn
+	seq    uint64
+	mtype  *methodType
+	send   *window
+	recv   *recvQueue
+}
+
+// Context 返回流的ctx， 客户端取消、deadline到达或者连接断开时被取消
+func (s *ServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// Send 向客户端发送一条消息， 客户端来不及接收时阻塞等待
+func (s *ServerStream) Send(v interface{}) error {
+	if err := s.send.take(s.ctx, nil); err != nil {
+		return err
+	}
+	return s.server.sendResponse(s.sc, &codec.Header{Seq: s.seq, Type: codec.MsgStream}, v)
+}
+
+// Recv 读取客户端发送的下一条消息到v中， 客户端调用CloseSend后返回io.EOF
+func (s *ServerStream) Recv(v interface{}) error {
+	argv, update, err := s.recv.pop(s.ctx)
+	if err != nil {
+		return err
+	}
+	if update {
+		_ = s.server.sendResponse(s.sc, &codec.Header{Seq: s.seq, Type: codec.MsgWindowUpdate}, invalidRequest)
+	}
+	return assignTo(v, argv)
+}
+
+// 读取连接的goroutine收到属于已有流的消息
+func (sc *serverConn) dispatchStream(h *codec.Header) error {
+	sc.mu.Lock()
+	s := sc.streams[h.Seq]
+	sc.mu.Unlock()
+	if s == nil {
+		// 流已经结束， 丢弃
+		return sc.cc.ReadBody(nil)
+	}
+	switch h.Type {
+	case codec.MsgStream:
+		argv, err := readArgv(sc.cc, s.mtype)
+		if err != nil {
+			s.recv.finish(err)
+			sc.cancel(h.Seq)
+			return nil
+		}
+		if !s.recv.push(argv) {
+			s.recv.finish(errStreamOverflow)
+			sc.cancel(h.Seq)
+		}
+	case codec.MsgStreamEnd:
+		s.recv.finish(nil)
+		return sc.cc.ReadBody(nil)
+	case codec.MsgWindowUpdate:
+		s.send.add(streamWindowUpdate)
+		return sc.cc.ReadBody(nil)
+	}
+	return nil
+}
+
+// openStream 在读取连接的goroutine中注册新的流， 保证之后到达的消息能够找到这个流
+// 流的ctx只受客户端的deadline限制， 不受HandleTimeout限制
+func (sc *serverConn) openStream(ctx context.Context, server *Server, req *request) *ServerStream {
+	var cancel context.CancelFunc
+	if d := time.Duration(req.h.Timeout); d > 0 {
+		ctx, cancel = context.WithTimeout(ctx, d)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	ctx, _ = newIncomingContext(ctx, req.h.Metadata)
+	s := &ServerStream{
+		ctx:    ctx,
+		cancel: cancel,
+		server: server,
+		sc:     sc,
+		seq:    req.h.Seq,
+		mtype:  req.mtype,
+		send:   newWindow(),
+		recv:   newRecvQueue(),
+	}
+	sc.mu.Lock()
+	sc.streams[s.seq] = s
+	sc.inflight[s.seq] = cancel
+	sc.mu.Unlock()
+	return s
+}
+
+// closeStream 在流结束后将它从连接上移除
+func (sc *serverConn) closeStream(s *ServerStream) {
+	sc.mu.Lock()
+	delete(sc.streams, s.seq)
+	delete(sc.inflight, s.seq)
+	sc.mu.Unlock()
+	s.cancel()
+}
+
+// handleStream 执行流式方法， 方法返回后发送MsgStreamEnd
+// waitErr不为nil表示流在队列中等待名额时被取消或者超时
+func (server *Server) handleStream(s *ServerStream, req *request, waitErr error) {
+	sc := s.sc
+	defer sc.wg.Done()
+	defer atomic.AddInt32(&sc.active, -1)
+	defer sc.closeStream(s)
+
+	h := &codec.Header{Seq: s.seq, Type: codec.MsgStreamEnd}
+	if waitErr != nil {
+		server.countRejected(req, waitErr)
+		setError(h, waitErr)
+		_ = server.sendResponse(sc, h, invalidRequest)
+		return
+	}
+	req.replyv = reflect.ValueOf(s)
+	err := func() error {
+		defer sc.lim.release(sc.sem)
+		return server.invoke(s.ctx, req)
+	}()
+	if err == nil && s.ctx.Err() != nil {
+		err = contextError(s.ctx)
+	}
+	if err != nil {
+		setError(h, err)
+	}
+	_ = server.sendResponse(sc, h, invalidRequest)
+}
+
+// ClientStream 是客户端一侧的流， 由Client.NewStream或Client.Stream创建
+//
+//	stream, err := client.Stream(ctx, "Foo.Count", args, &reply)
+//	for stream.Next() {
+//		// 使用reply
+//	}
+//	err = stream.Err()
+//
+// 不再读取时需要取消ctx， 以便释放服务端的资源
+type ClientStream struct {
+	ctx    context.Context
+	client *Client
+	seq    uint64
+	reply  interface{}  // 每次Next读取的消息保存在这里
+	typ    reflect.Type // 服务端发送的消息类型
+	send   *window
+	recv   *recvQueue
+	err    error
+	closed int32 // 客户端已经调用CloseSend
+}
+
+// NewStream 调用服务端的流式方法， args作为第一条消息发送， 服务端发送的消息依次读取到reply中，
+// reply必须是指针。 返回的流可以继续Send， 发送完毕后调用CloseSend。
+func (client *Client) NewStream(ctx context.Context, serviceMethod string, args, reply interface{}) (*ClientStream, error) {
+	rv := reflect.ValueOf(reply)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return nil, NewError(CodeInvalidArgument, "rpc client: stream reply must be a non-nil pointer")
+	}
+	timeout, err := requestTimeout(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s := &ClientStream{
+		ctx:    ctx,
+		client: client,
+		reply:  reply,
+		typ:    rv.Type().Elem(),
+		send:   newWindow(),
+		recv:   newRecvQueue(),
+	}
+	client.mu.Lock()
+	if client.closing || client.shutdown {
+		client.mu.Unlock()
+		return nil, ErrShutdown
+	}
+	s.seq = client.seq
+	client.seq++
+	client.streams[s.seq] = s
+	client.mu.Unlock()
+
+	h := &codec.Header{ServiceMethod: serviceMethod, Seq: s.seq, Type: codec.MsgStream}
+	h.Metadata, _ = FromOutgoingContext(ctx)
+	h.Timeout = int64(timeout)
+	if err := client.write(h, args); err != nil {
+		client.removeStream(s.seq)
+		return nil, err
+	}
+	// 读取消息时会检查ctx， 没有读取时也需要及时通知服务端
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.abort(ctx.Err())
+		case <-s.recv.done:
+		}
+	}()
+	return s, nil
+}
+
+// Stream 调用服务端流式方法， 只发送args一条消息， 适用于服务端流式调用
+func (client *Client) Stream(ctx context.Context, serviceMethod string, args, reply interface{}) (*ClientStream, error) {
+	s, err := client.NewStream(ctx, serviceMethod, args, reply)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.CloseSend(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Send 向服务端发送一条消息， 服务端来不及接收时阻塞等待
+func (s *ClientStream) Send(v interface{}) error {
+	if atomic.LoadInt32(&s.closed) == 1 {
+		return errStreamClosed
+	}
+	if err := s.send.take(s.ctx, s.recv.done); err != nil {
+		return err
+	}
+	return s.client.write(&codec.Header{Seq: s.seq, Type: codec.MsgStream}, v)
+}
+
+// CloseSend 通知服务端不会再发送消息， 服务端的Recv将返回io.EOF
+func (s *ClientStream) CloseSend() error {
+	if !atomic.CompareAndSwapInt32(&s.closed, 0, 1) {
+		return nil
+	}
+	return s.client.write(&codec.Header{Seq: s.seq, Type: codec.MsgStreamEnd}, invalidRequest)
+}
+
+// Next 读取服务端发送的下一条消息到reply中， 流结束或出错时返回false
+func (s *ClientStream) Next() bool {
+	v, update, err := s.recv.pop(s.ctx)
+	if err != nil {
+		if err != io.EOF {
+			s.err = err
+		}
+		return false
+	}
+	if update {
+		_ = s.client.write(&codec.Header{Seq: s.seq, Type: codec.MsgWindowUpdate}, invalidRequest)
+	}
+	if err = assignTo(s.reply, v); err != nil {
+		s.err = err
+		s.abort(err)
+		return false
+	}
+	return true
+}
+
+// Err 返回使流结束的错误， 正常结束时返回nil
+func (s *ClientStream) Err() error {
+	return s.err
+}
+
+// abort 在客户端放弃流时通知服务端
+func (s *ClientStream) abort(err error) {
+	if s.client.removeStream(s.seq) != nil {
+		s.client.cancel(s.seq)
+	}
+	s.recv.finish(err)
+}
+
+func (client *Client) removeStream(seq uint64) *ClientStream {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	s := client.streams[seq]
+	delete(client.streams, seq)
+	return s
+}
+
+// 读取连接的goroutine收到流消息， 返回false表示这条消息不属于任何流
+func (client *Client) dispatchStream(h *codec.Header) (bool, error) {
+	client.mu.Lock()
+	s := client.streams[h.Seq]
+	client.mu.Unlock()
+	if s == nil {
+		return false, nil
+	}
+	switch h.Type {
+	case codec.MsgStream:
+		v := reflect.New(s.typ)
+		if err := client.cc.ReadBody(v.Interface()); err != nil {
+			return true, err
+		}
+		if !s.recv.push(v.Elem()) {
+			s.abort(errStreamOverflow)
+		}
+		return true, nil
+	case codec.MsgStreamEnd:
+		client.removeStream(h.Seq)
+		if h.Error != "" {
+			s.recv.finish(serverError(h))
+		} else {
+			s.recv.finish(nil)
+		}
+	case codec.MsgWindowUpdate:
+		s.send.add(streamWindowUpdate)
+	}
+	return true, client.cc.ReadBody(nil)
+}
+
+// write 发送一条消息， 与请求共用发送锁
+func (client *Client) write(h *codec.Header, body interface{}) error {
+	client.sending.Lock()
+	defer client.sending.Unlock()
+	if err := client.cc.Write(h, body); err != nil {
+		log.Println("rpc client: write error:", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package geerpc
+
+import (
+	"context"
+	"errors"
+	"geerpc/codec"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Counter struct{ canceled chan error }
+
+// Count sends 0..n-1, more than the initial window
+func (c *Counter) Count(n int, stream *ServerStream) error {
+	for i := 0; i < n; i++ {
+		if err := stream.Send(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sum adds up all numbers sent by the client
+func (c *Counter) Sum(n int, stream *ServerStream) error {
+	sum := n
+	for {
+		err := stream.Recv(&n)
+		if err == io.EOF {
+			return stream.Send(sum)
+		}
+		if err != nil {
+			return err
+		}
+		sum += n
+	}
+}
+
+// Double replies to every number with its double
+func (c *Counter) Double(n int, stream *ServerStream) error {
+	for {
+		if err := stream.Send(n * 2); err != nil {
+			return err
+		}
+		if err := stream.Recv(&n); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (c *Counter) Fail(n int, stream *ServerStream) error {
+	_ = stream.Send(n)
+	return errors.New("counter failed")
+}
+
+func (c *Counter) Forever(n int, stream *ServerStream) error {
+	<-stream.Context().Done()
+	c.canceled <- stream.Context().Err()
+	return nil
+}
+
+func (c *Counter) Unary(n int, reply *int) error {
+	*reply = n
+	return nil
+}
+
+func TestClient_Stream(t *testing.T) {
+	t.Parallel()
+	counter := &Counter{canceled: make(chan error, 1)}
+	server := NewServer()
+	_ = server.Register(counter)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+
+	for _, typ := range []codec.Type{codec.GobType, codec.JsonType, codec.BinaryType, codec.MsgpackType} {
+		t.Run(string(typ), func(t *testing.T) {
+			client, err := Dial("tcp", l.Addr().String(), &Option{CodecType: typ})
+			_assert(err == nil, "failed to dial with %s: %v", typ, err)
+			defer func() { _ = client.Close() }()
+			ctx := context.Background()
+
+			var n int
+			stream, err := client.Stream(ctx, "Counter.Count", 100, &n)
+			_assert(err == nil, "failed to open stream: %v", err)
+			want := 0
+			for stream.Next() {
+				_assert(n == want, "expect %d, but got %d", want, n)
+				want++
+			}
+			_assert(stream.Err() == nil && want == 100, "expect 100 messages, got %d, %v", want, stream.Err())
+
+			stream, err = client.NewStream(ctx, "Counter.Sum", 1, &n)
+			_assert(err == nil, "failed to open stream: %v", err)
+			for i := 2; i <= 100; i++ {
+				_assert(stream.Send(i) == nil, "failed to send %d", i)
+			}
+			_ = stream.CloseSend()
+			_assert(stream.Next() && n == 5050, "expect sum 5050, but got %d, %v", n, stream.Err())
+			_assert(!stream.Next() && stream.Err() == nil, "expect the stream to end, got %v", stream.Err())
+
+			stream, err = client.NewStream(ctx, "Counter.Double", 1, &n)
+			_assert(err == nil, "failed to open stream: %v", err)
+			for i := 1; i <= 50; i++ {
+				_assert(stream.Next() && n == i*2, "expect %d, but got %d, %v", i*2, n, stream.Err())
+				_ = stream.Send(i + 1)
+			}
+			_ = stream.CloseSend()
+			_assert(stream.Next() && n == 102, "expect 102, but got %d", n)
+			_assert(!stream.Next() && stream.Err() == nil, "expect the stream to end, got %v", stream.Err())
+
+			stream, _ = client.Stream(ctx, "Counter.Fail", 7, &n)
+			_assert(stream.Next() && n == 7, "expect the message sent before the error")
+			_assert(!stream.Next() && stream.Err() != nil && stream.Err().Error() == "counter failed",
+				"expect the error frame, but got %v", stream.Err())
+
+			// streaming and unary methods can't be mixed up
+			stream, _ = client.Stream(ctx, "Counter.Unary", 1, &n)
+			_assert(!stream.Next() && strings.Contains(stream.Err().Error(), "not a streaming method"), "expect an error")
+			err = client.Call(ctx, "Counter.Count", 1, &n)
+			_assert(err != nil && strings.Contains(err.Error(), "is a streaming method"), "expect an error")
+
+			cctx, cancel := context.WithCancel(ctx)
+			stream, _ = client.Stream(cctx, "Counter.Forever", 1, &n)
+			time.AfterFunc(100*time.Millisecond, cancel)
+			_assert(!stream.Next() && stream.Err() == context.Canceled, "expect canceled, but got %v", stream.Err())
+			select {
+			case err := <-counter.canceled:
+				_assert(err == context.Canceled, "expect the server stream to be canceled, got %v", err)
+			case <-time.After(time.Second):
+				t.Fatal("expect the server stream to be canceled")
+			}
+
+			// the connection still works
+			err = client.Call(ctx, "Counter.Unary", 3, &n)
+			_assert(err == nil && n == 3, "connection broken after streaming with %s: %v", typ, err)
+		})
+	}
+}
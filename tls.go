@@ -0,0 +1,113 @@
+package geerpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"time"
+)
+
+// 服务端等待TLS握手完成的最长时间
+const tlsHandshakeTimeout = 10 * time.Second
+
+// 服务端等待客户端发送Option并完成认证的最长时间
+const handshakeTimeout = 10 * time.Second
+
+// peer 记录连接对端的信息
+type peer struct {
+	remote string
+	tls    *tls.ConnectionState // 非TLS连接为nil
+
+	principal string // 通过认证的调用方身份
+}
+
+// 获取连接对端的信息， TLS连接先完成握手， 以便取得对端的证书
+func handshake(conn io.ReadWriteCloser) (peer, error) {
+	var p peer
+	if c, ok := conn.(net.Conn); ok {
+		p.remote = c.RemoteAddr().String()
+	}
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		return p, nil
+	}
+	_ = tc.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	if err := tc.Handshake(); err != nil {
+		return p, err
+	}
+	_ = tc.SetDeadline(time.Time{})
+	state := tc.ConnectionState()
+	p.tls = &state
+	return p, nil
+}
+
+// 客户端证书通过了验证时， 以证书Subject的CommonName作为调用方身份
+func (p *peer) certPrincipal() string {
+	if p.tls == nil || len(p.tls.VerifiedChains) == 0 {
+		return ""
+	}
+	return p.tls.PeerCertificates[0].Subject.CommonName
+}
+
+// SetTLSConfig 设置服务器的TLS配置， 之后Accept接受的连接都使用TLS， config为nil时不使用TLS；
+// 需要验证客户端证书（mutual TLS）时设置config.ClientCAs和config.ClientAuth = tls.RequireAndVerifyClientCert，
+// 没有使用Authenticator认证的连接以证书Subject的CommonName作为调用方身份， 交给Authorizer检查
+func (server *Server) SetTLSConfig(config *tls.Config) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.tlsConfig = config
+}
+
+// AcceptTLS 在lis上接受TLS连接， config中设置服务端证书， 与SetTLSConfig之后调用Accept相同，
+// 但只对这个监听器生效
+func (server *Server) AcceptTLS(lis net.Listener, config *tls.Config) {
+	server.serve(tls.NewListener(lis, config))
+}
+
+// AcceptTLS 隐式调用单例类服务器
+func AcceptTLS(lis net.Listener, config *tls.Config) { DefaultServer.AcceptTLS(lis, config) }
+
+// RemoteAddr 返回客户端的地址
+func (c *Conn) RemoteAddr() string {
+	return c.sc.peer.remote
+}
+
+// TLSState 返回TLS连接的状态， 非TLS连接返回nil
+func (c *Conn) TLSState() *tls.ConnectionState {
+	return c.sc.peer.tls
+}
+
+// PeerCertificate 在服务方法中返回客户端的证书， 只有客户端提供了证书的TLS连接才会返回true；
+// 要求验证客户端证书时， 这个证书已经通过了验证， 可以用它的Subject或SAN识别调用方
+func PeerCertificate(ctx context.Context) (*x509.Certificate, bool) {
+	c, ok := ConnFromContext(ctx)
+	if !ok || c.TLSState() == nil || len(c.TLSState().PeerCertificates) == 0 {
+		return nil, false
+	}
+	return c.TLSState().PeerCertificates[0], true
+}
+
+// 建立到服务端的连接， 设置了Option.TLSConfig时使用TLS
+func dialConn(network, address string, opt *Option) (net.Conn, error) {
+	if opt.TLSConfig == nil {
+		return net.DialTimeout(network, address, opt.ConnectTimeout)
+	}
+	return tls.DialWithDialer(&net.Dialer{Timeout: opt.ConnectTimeout}, network, address, opt.TLSConfig)
+}
+
+// DialTLS connects to an RPC server at the specified network address over TLS,
+// the default tls.Config is used when Option.TLSConfig is nil.
+func DialTLS(network, address string, opts ...*Option) (*Client, error) {
+	opt, err := parseOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if opt.TLSConfig == nil {
+		o := *opt
+		o.TLSConfig = &tls.Config{}
+		opt = &o
+	}
+	return dialTimeout(NewClient, network, address, opt)
+}
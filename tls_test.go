@@ -0,0 +1,144 @@
+package geerpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// issue creates a certificate signed by parent, or a self-signed CA when parent is nil
+func issue(t *testing.T, name string, parent *tls.Certificate, ca bool) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_assert(err == nil, "failed to generate key: %v", err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+	}
+	tmpl.IsCA, tmpl.BasicConstraintsValid = ca, ca
+	signer, signerKey := tmpl, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	_assert(err == nil, "failed to create certificate: %v", err)
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+type Whoami int
+
+func (w Whoami) Name(ctx context.Context, _ int, reply *string) error {
+	cert, ok := PeerCertificate(ctx)
+	if !ok {
+		return errors.New("no client certificate")
+	}
+	*reply = cert.Subject.CommonName
+	return nil
+}
+
+func TestServer_AcceptTLS(t *testing.T) {
+	t.Parallel()
+	ca := issue(t, "test ca", nil, true)
+	serverCert := issue(t, "server", &ca, false)
+	clientCert := issue(t, "alice", &ca, false)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	server := NewServer()
+	var w Whoami
+	_ = server.Register(&w)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.AcceptTLS(l, &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	})
+	addr := l.Addr().String()
+
+	client, err := XDial("tls@"+addr, &Option{TLSConfig: &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{clientCert},
+	}})
+	_assert(err == nil, "failed to dial over tls: %v", err)
+	defer func() { _ = client.Close() }()
+	var name string
+	err = client.Call(context.Background(), "Whoami.Name", 0, &name)
+	_assert(err == nil && name == "alice", "expect the client identity, got %q, %v", name, err)
+
+	// without a client certificate the connection works, but there is no identity
+	anonymous, err := DialTLS("tcp", addr, &Option{TLSConfig: &tls.Config{RootCAs: pool}})
+	_assert(err == nil, "failed to dial over tls: %v", err)
+	defer func() { _ = anonymous.Close() }()
+	err = anonymous.Call(context.Background(), "Whoami.Name", 0, &name)
+	_assert(err != nil && err.Error() == "no client certificate", "expect no identity, got %v", err)
+
+	// the server certificate is not trusted by default
+	_, err = XDial("tls@" + addr)
+	_assert(err != nil, "expect an unknown authority error")
+	// plain connections are closed by the server
+	plain, err := Dial("tcp", addr)
+	_assert(err == nil, "failed to dial: %v", err)
+	defer func() { _ = plain.Close() }()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = plain.Call(ctx, "Whoami.Name", 0, &name)
+	_assert(err != nil, "expect plain connections to fail")
+}
+
+func TestServer_SetTLSConfig(t *testing.T) {
+	t.Parallel()
+	ca := issue(t, "test ca", nil, true)
+	serverCert := issue(t, "server", &ca, false)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	server := NewServer()
+	var p Principal
+	_ = server.Register(&p)
+	server.SetTLSConfig(&tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	// the verified certificate identifies the caller to the authorizer
+	acl := NewACL()
+	acl.Allow("alice", "Principal.*")
+	server.SetAuthorizer(acl)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	dial := func(name string) *Client {
+		cert := issue(t, name, &ca, false)
+		client, err := DialTLS("tcp", l.Addr().String(), &Option{TLSConfig: &tls.Config{
+			RootCAs:      pool,
+			Certificates: []tls.Certificate{cert},
+		}})
+		_assert(err == nil, "failed to dial over tls: %v", err)
+		return client
+	}
+	alice := dial("alice")
+	defer func() { _ = alice.Close() }()
+	var principal string
+	err := alice.Call(context.Background(), "Principal.Get", 0, &principal)
+	_assert(err == nil && principal == "alice", "expect the certificate to be the principal, got %q, %v", principal, err)
+
+	bob := dial("bob")
+	defer func() { _ = bob.Close() }()
+	err = bob.Call(context.Background(), "Principal.Get", 0, &principal)
+	_assert(err == ErrPermissionDenied, "expect ErrPermissionDenied, got %v", err)
+}
@@ -0,0 +1,221 @@
+package geerpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentKey 是元数据中携带W3C traceparent的key， 格式为
+//
+//	00-<32位十六进制trace id>-<16位十六进制parent span id>-<2位十六进制flags>
+//
+// 参见 https://www.w3.org/TR/trace-context/
+const TraceparentKey = "traceparent"
+
+// Span 记录一次调用在客户端或服务端的耗时与结果
+type Span struct {
+	Name       string            `json:"name"` // 格式“Service.Method”
+	Kind       string            `json:"kind"` // "client"或"server"
+	TraceID    string            `json:"trace_id"`
+	SpanID     string            `json:"span_id"`
+	ParentID   string            `json:"parent_id,omitempty"` // 为空表示根span
+	Sampled    bool              `json:"sampled"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Error      string            `json:"error,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Duration 返回span的耗时
+func (s *Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// traceparent 返回以s为parent的traceparent
+func (s *Span) traceparent() string {
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+	return "00-" + s.TraceID + "-" + s.SpanID + "-" + flags
+}
+
+// SpanExporter 接收结束的span， 只有被采样的span才会导出
+type SpanExporter interface {
+	ExportSpan(span *Span)
+}
+
+type spanKey struct{}
+
+// SpanFromContext 返回ctx中正在进行的span， 服务方法的ctx中为服务端span
+func SpanFromContext(ctx context.Context) (*Span, bool) {
+	span, ok := ctx.Value(spanKey{}).(*Span)
+	return span, ok
+}
+
+// 解析traceparent， 返回trace id、parent span id和是否采样
+func parseTraceparent(s string) (traceID, parentID string, sampled bool, err error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 4 || parts[0] != "00" || !isHex(parts[1], 32) || !isHex(parts[2], 16) || !isHex(parts[3], 2) {
+		return "", "", false, errors.New("rpc: invalid traceparent " + s)
+	}
+	if parts[1] == strings.Repeat("0", 32) || parts[2] == strings.Repeat("0", 16) {
+		return "", "", false, errors.New("rpc: invalid traceparent " + s)
+	}
+	flags, _ := hex.DecodeString(parts[3])
+	return parts[1], parts[2], flags[0]&1 == 1, nil
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// 创建一个新的span， parent为nil时开始一个新的trace
+func newSpan(name, kind string, parent *Span) *Span {
+	span := &Span{
+		Name:    name,
+		Kind:    kind,
+		SpanID:  randomID(8),
+		Start:   time.Now(),
+		Sampled: true,
+	}
+	if parent != nil {
+		span.TraceID, span.ParentID, span.Sampled = parent.TraceID, parent.SpanID, parent.Sampled
+	} else {
+		span.TraceID = randomID(16)
+	}
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		span.Attributes = map[string]string{"rpc.service": name[:dot], "rpc.method": name[dot+1:]}
+	}
+	return span
+}
+
+// 结束span并导出
+func (s *Span) finish(exporter SpanExporter, err error) {
+	s.End = time.Now()
+	if err != nil {
+		s.Error = err.Error()
+	}
+	if s.Sampled {
+		exporter.ExportSpan(s)
+	}
+}
+
+// TracingServerInterceptor 返回记录服务端span的拦截器：
+// 从请求元数据的traceparent中取出调用方的span， 为服务方法的调用创建子span，
+// 服务方法可以通过SpanFromContext获得这个span。 没有合法traceparent的请求开始新的trace
+func TracingServerInterceptor(exporter SpanExporter) ServerInterceptor {
+	return func(ctx context.Context, info *ServerInfo, argv, replyv interface{}, next Handler) error {
+		var parent *Span
+		if md, ok := FromIncomingContext(ctx); ok {
+			if traceID, parentID, sampled, err := parseTraceparent(md[TraceparentKey]); err == nil {
+				parent = &Span{TraceID: traceID, SpanID: parentID, Sampled: sampled}
+			}
+		}
+		span := newSpan(info.ServiceMethod, "server", parent)
+		err := next(context.WithValue(ctx, spanKey{}, span), argv, replyv)
+		span.finish(exporter, err)
+		return err
+	}
+}
+
+// TracingClientInterceptor 返回记录客户端span的拦截器：
+// ctx中有span时（例如在服务方法中继续调用其他服务）创建它的子span， 否则开始新的trace，
+// 并将traceparent放入请求元数据
+func TracingClientInterceptor(exporter SpanExporter) ClientInterceptor {
+	return func(ctx context.Context, serviceMethod string, args, reply interface{}, invoker Invoker) error {
+		parent, _ := SpanFromContext(ctx)
+		span := newSpan(serviceMethod, "client", parent)
+		md, _ := FromOutgoingContext(ctx)
+		md = md.Copy()
+		if md == nil {
+			md = Metadata{}
+		}
+		md[TraceparentKey] = span.traceparent()
+		ctx = context.WithValue(NewOutgoingContext(ctx, md), spanKey{}, span)
+		err := invoker(ctx, serviceMethod, args, reply)
+		span.finish(exporter, err)
+		return err
+	}
+}
+
+// InMemoryExporter 将span保存在内存中， 用于测试
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// ExportSpan implements SpanExporter
+func (e *InMemoryExporter) ExportSpan(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans 按结束顺序返回所有导出的span
+func (e *InMemoryExporter) Spans() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+// Reset 清空保存的span
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+// FileExporter 将span以JSON lines格式追加写入文件， 每行一个span
+type FileExporter struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// NewFileExporter 以追加方式打开path
+func NewFileExporter(path string) (*FileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// ExportSpan implements SpanExporter， 写入失败时只记录日志
+func (e *FileExporter) ExportSpan(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.enc.Encode(span); err != nil {
+		log.Println("rpc: export span error:", err)
+	}
+}
+
+// Close 关闭文件
+func (e *FileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.f.Close()
+}
@@ -0,0 +1,104 @@
+package geerpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Relay forwards Foo.Sum to another server
+type Relay struct{ backend *Client }
+
+func (r *Relay) Sum(ctx context.Context, args Args, reply *int) error {
+	return r.backend.Call(ctx, "Foo.Sum", args, reply)
+}
+
+func startTracedServer(exporter SpanExporter, rcvr interface{}) string {
+	server := NewServer()
+	server.Use(TracingServerInterceptor(exporter))
+	_ = server.Register(rcvr)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	return l.Addr().String()
+}
+
+func TestTracing(t *testing.T) {
+	t.Parallel()
+	exporter := new(InMemoryExporter)
+	opt := &Option{Interceptors: []ClientInterceptor{TracingClientInterceptor(exporter)}}
+	var foo Foo
+	backend, _ := Dial("tcp", startTracedServer(exporter, &foo), opt)
+	defer func() { _ = backend.Close() }()
+	frontend, _ := Dial("tcp", startTracedServer(exporter, &Relay{backend: backend}), opt)
+	defer func() { _ = frontend.Close() }()
+
+	var reply int
+	err := frontend.Call(context.Background(), "Relay.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "failed to call Relay.Sum: %v", err)
+
+	spans := exporter.Spans()
+	_assert(len(spans) == 4, "expect 4 spans, but got %d", len(spans))
+	// spans are exported when they end, the innermost first
+	backendServer, backendClient, frontendServer, root := spans[0], spans[1], spans[2], spans[3]
+	_assert(root.Kind == "client" && root.Name == "Relay.Sum" && root.ParentID == "", "expect the root span, got %+v", root)
+	_assert(frontendServer.Kind == "server" && frontendServer.ParentID == root.SpanID, "wrong frontend span %+v", frontendServer)
+	_assert(backendClient.Kind == "client" && backendClient.ParentID == frontendServer.SpanID, "wrong client span %+v", backendClient)
+	_assert(backendServer.Name == "Foo.Sum" && backendServer.ParentID == backendClient.SpanID, "wrong backend span %+v", backendServer)
+	for _, span := range spans {
+		_assert(span.TraceID == root.TraceID && span.Sampled, "expect one sampled trace")
+		_assert(span.Duration() > 0 && span.Error == "", "wrong span %+v", span)
+	}
+	_assert(backendServer.Attributes["rpc.service"] == "Foo", "expect the service attribute")
+
+	// not sampled upstream, so nothing is exported
+	exporter.Reset()
+	ctx := NewOutgoingContext(context.Background(), Metadata{TraceparentKey: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"})
+	client, _ := Dial("tcp", startTracedServer(exporter, &foo))
+	defer func() { _ = client.Close() }()
+	_ = client.Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(len(exporter.Spans()) == 0, "expect unsampled spans not to be exported")
+}
+
+func TestParseTraceparent(t *testing.T) {
+	traceID, parentID, sampled, err := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_assert(err == nil && traceID == "4bf92f3577b34da6a3ce929d0e0e4736" && parentID == "00f067aa0ba902b7" && sampled,
+		"failed to parse traceparent: %v", err)
+	for _, s := range []string{
+		"",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+	} {
+		_, _, _, err = parseTraceparent(s)
+		_assert(err != nil, "expect %q to be invalid", s)
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geerpc")
+	_assert(err == nil, "failed to create temp dir: %v", err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "spans.jsonl")
+	exporter, err := NewFileExporter(path)
+	_assert(err == nil, "failed to create exporter: %v", err)
+	exporter.ExportSpan(newSpan("Foo.Sum", "client", nil))
+	exporter.ExportSpan(newSpan("Foo.Sum", "server", nil))
+	_assert(exporter.Close() == nil, "failed to close exporter")
+
+	f, _ := os.Open(path)
+	defer func() { _ = f.Close() }()
+	scanner := bufio.NewScanner(f)
+	var kinds []string
+	for scanner.Scan() {
+		var span Span
+		_assert(json.Unmarshal(scanner.Bytes(), &span) == nil, "expect one JSON span per line")
+		kinds = append(kinds, span.Kind)
+	}
+	_assert(len(kinds) == 2 && kinds[0] == "client" && kinds[1] == "server", "wrong spans %v", kinds)
+}
@@ -0,0 +1,103 @@
+package xclient
+
+import (
+	"context"
+	"fmt"
+	. "geerpc"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// call outcomes recorded per endpoint
+const (
+	OutcomeOK        = "ok"
+	OutcomeError     = "error"      // the server returned an error
+	OutcomeBusy      = "busy"       // the server rejected the call with ErrServerBusy
+	OutcomeCanceled  = "canceled"   // ctx was canceled or its deadline exceeded
+	OutcomeDialError = "dial_error" // failed to connect to the server
+)
+
+// MaxEndpoints is the number of endpoints EndpointMetrics keeps apart,
+// calls to further endpoints are counted under OtherEndpoint so that
+// servers coming and going through discovery can't grow the metrics forever.
+const MaxEndpoints = 256
+
+// OtherEndpoint is the endpoint label of the calls beyond MaxEndpoints.
+const OtherEndpoint = "other"
+
+// EndpointMetrics counts the outcomes of calls made by XClients per endpoint.
+type EndpointMetrics struct {
+	mu    sync.Mutex
+	calls map[string]map[string]uint64 // endpoint -> outcome -> count
+}
+
+// Metrics collects the outcomes of the calls of all XClients,
+// pass it to geerpc.HandleMetrics or Server.MetricsHandler to export them.
+var Metrics = &EndpointMetrics{}
+
+var _ MetricsWriter = (*EndpointMetrics)(nil)
+
+func (m *EndpointMetrics) record(endpoint, outcome string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.calls == nil {
+		m.calls = make(map[string]map[string]uint64)
+	}
+	if m.calls[endpoint] == nil {
+		if len(m.calls) >= MaxEndpoints {
+			endpoint = OtherEndpoint
+		}
+		if m.calls[endpoint] == nil {
+			m.calls[endpoint] = make(map[string]uint64)
+		}
+	}
+	m.calls[endpoint][outcome]++
+}
+
+// Count returns the number of calls to endpoint with the given outcome.
+func (m *EndpointMetrics) Count(endpoint, outcome string) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[endpoint][outcome]
+}
+
+// WriteMetrics writes the call outcomes in the Prometheus text format.
+func (m *EndpointMetrics) WriteMetrics(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	endpoints := make([]string, 0, len(m.calls))
+	for endpoint := range m.calls {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	fmt.Fprintf(w, "# HELP geerpc_xclient_calls_total Number of calls made by XClients by endpoint and outcome.\n")
+	fmt.Fprintf(w, "# TYPE geerpc_xclient_calls_total counter\n")
+	for _, endpoint := range endpoints {
+		outcomes := make([]string, 0, len(m.calls[endpoint]))
+		for outcome := range m.calls[endpoint] {
+			outcomes = append(outcomes, outcome)
+		}
+		sort.Strings(outcomes)
+		for _, outcome := range outcomes {
+			fmt.Fprintf(w, "geerpc_xclient_calls_total{endpoint=\"%s\",outcome=\"%s\"} %d\n",
+				labelEscaper.Replace(endpoint), labelEscaper.Replace(outcome), m.calls[endpoint][outcome])
+		}
+	}
+}
+
+// label values in the Prometheus text format only escape backslashes, double quotes and newlines
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func outcomeOf(ctx context.Context, err error) string {
+	switch {
+	case err == nil:
+		return OutcomeOK
+	case err == ErrServerBusy:
+		return OutcomeBusy
+	case ctx.Err() != nil:
+		return OutcomeCanceled
+	}
+	return OutcomeError
+}
@@ -19,6 +19,8 @@ type XClient struct {
 
 var _ io.Closer = (*XClient)(nil)
 
+// NewXClient creates a XClient, opt is used to dial every server,
+// so the client interceptors in opt.Interceptors apply to all of them.
 func NewXClient(d Discovery, mode SelectMode, opt *Option) *XClient {
 	return &XClient{d: d, mode: mode, opt: opt, clients: make(map[string]*Client)}
 }
@@ -54,23 +56,51 @@ func (xc *XClient) dial(rpcAddr string) (*Client, error) {
 	return client, nil
 }
 
+// the outcome of every call is recorded in Metrics
 func (xc *XClient) call(rpcAddr string, ctx context.Context, serviceMethod string, args, reply interface{}) error {
 	client, err := xc.dial(rpcAddr)
 	if err != nil {
+		Metrics.record(rpcAddr, OutcomeDialError)
 		return err
 	}
-	return client.Call(ctx, serviceMethod, args, reply)
+	err = client.Call(ctx, serviceMethod, args, reply)
+	Metrics.record(rpcAddr, outcomeOf(ctx, err))
+	return err
 }
 
 // Call invokes the named function, waits for it to complete,
 // and returns its error status.
 // xc will choose a proper server.
+// If the chosen server is busy, the other servers are tried in turn.
 func (xc *XClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
 	rpcAddr, err := xc.d.Get(xc.mode)
 	if err != nil {
 		return err
 	}
-	return xc.call(rpcAddr, ctx, serviceMethod, args, reply)
+	err = xc.call(rpcAddr, ctx, serviceMethod, args, reply)
+	if err != ErrServerBusy {
+		return err
+	}
+	servers, _ := xc.d.GetAll()
+	for _, addr := range servers {
+		if addr == rpcAddr {
+			continue
+		}
+		if err = xc.call(addr, ctx, serviceMethod, args, reply); err != ErrServerBusy {
+			return err
+		}
+	}
+	return err
+}
+
+// HealthCheck asks the server at rpcAddr for the serving status of service,
+// an empty service means the server as a whole.
+func (xc *XClient) HealthCheck(ctx context.Context, rpcAddr, service string) (ServingStatus, error) {
+	client, err := xc.dial(rpcAddr)
+	if err != nil {
+		return StatusUnknown, err
+	}
+	return client.HealthCheck(ctx, service)
 }
 
 // Broadcast invokes the named function for every server registered in discovery